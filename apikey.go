@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// APIKey lets a client use the message api when keys are required.  Only a
+// hash of the key is stored, the key itself is shown once when created.
+type APIKey struct {
+	ID         string     `gorm:"primary_key" json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `gorm:"size:12" json:"prefix"`
+	Hash       string     `gorm:"size:64;unique_index" json:"-"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// createAPIKey stores a new key, returning it with the plain key
+func createAPIKey(db *gorm.DB, name string) (*APIKey, string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", err
+	}
+	key := "gsm_" + hex.EncodeToString(random)
+
+	apiKey := APIKey{
+		ID:     uuid.New().String(),
+		Name:   name,
+		Prefix: key[:12],
+		Hash:   hashAPIKey(key),
+	}
+	if err := db.Create(&apiKey).Error; err != nil {
+		return nil, "", err
+	}
+	return &apiKey, key, nil
+}
+
+// validToken is true for the admin token or a stored api key
+func validToken(db *gorm.DB, adminToken string, given string) bool {
+	if given == "" {
+		return false
+	}
+	if adminToken != "" && subtle.ConstantTimeCompare([]byte(given), []byte(adminToken)) == 1 {
+		return true
+	}
+
+	var apiKey APIKey
+	if db.Where("hash = ?", hashAPIKey(given)).First(&apiKey).RecordNotFound() {
+		return false
+	}
+	db.Model(&apiKey).UpdateColumn("last_used_at", time.Now().UTC())
+	return true
+}
+
+// requestToken is the bearer token or access_token parameter of a request
+func requestToken(r *http.Request) string {
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if given == "" {
+		given = r.URL.Query().Get("access_token")
+	}
+	return given
+}
+
+// requireAPIKey checks for an api key or the admin token as a bearer token, or
+// an access_token parameter for clients like EventSource which can't set
+// headers.  The api is open unless keys are required.
+func requireAPIKey(db *gorm.DB, adminToken string, required bool, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if required {
+			if !validToken(db, adminToken, requestToken(r)) {
+				http.Error(w, "401 Unauthorized.", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		handler(w, r)
+	}
+}
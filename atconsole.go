@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// defaultATAllow are read only queries, allowed unless an allow list is given
+var defaultATAllow = []string{"AT+CSQ", "AT+CREG?", "AT+COPS?", "AT+CPMS?", "ATI"}
+
+// defaultATDeny are commands which would reset the modem or change the
+// settings the gateway relies on, touch stored and outgoing messages, make or
+// answer calls or USSD requests, or change the SIM's locks and the port speed.
+// They are refused even when allowed.
+var defaultATDeny = []string{"ATZ", "AT&F", "ATE", "ATD", "ATA", "ATS0=", "AT+CFUN", "AT+CPOF", "AT+CMGF", "AT+CMGS", "AT+CMGD", "AT+CMGW", "AT+CMSS", "AT+CNMI", "AT+CPMS=", "AT+CSCA=", "AT+CUSD", "AT+CPIN", "AT+CLCK", "AT+CPWD", "AT+IPR"}
+
+// atConsole runs raw AT commands for administrators, restricted by prefix
+// lists
+type atConsole struct {
+	allow []string
+	deny  []string
+}
+
+func newATConsole(allow string, deny string) *atConsole {
+	console := &atConsole{allow: defaultATAllow, deny: defaultATDeny}
+	if allow != "" {
+		console.allow = strings.Split(strings.ToUpper(allow), ",")
+	}
+	if deny != "" {
+		console.deny = append(append([]string{}, defaultATDeny...), strings.Split(strings.ToUpper(deny), ",")...)
+	}
+	return console
+}
+
+func hasCommandPrefix(command string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSpace(prefix)
+		if prefix != "" && strings.HasPrefix(command, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// permitted checks a single command line against the lists
+func (c *atConsole) permitted(command string) bool {
+	// no chained commands, line endings or body and escape characters
+	if strings.ContainsAny(command, ";\r\n\x1a\x1b") {
+		return false
+	}
+	// modems ignore spaces, so they can't be used to dodge the lists
+	command = strings.ToUpper(strings.Join(strings.Fields(command), ""))
+	if !strings.HasPrefix(command, "AT") {
+		return false
+	}
+	if hasCommandPrefix(command, c.deny) {
+		return false
+	}
+	return hasCommandPrefix(command, c.allow)
+}
+
+// ATCommand is the audit log of console use, including refused commands
+type ATCommand struct {
+	ID         string    `gorm:"primary_key" json:"id"`
+	Command    string    `json:"command"`
+	Permitted  bool      `json:"permitted"`
+	Response   string    `json:"response"`
+	Error      string    `json:"error,omitempty"`
+	RemoteAddr string    `json:"remote_addr"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type atCommandResult struct {
+	Command string   `json:"command"`
+	Lines   []string `json:"lines"`
+	Error   string   `json:"error,omitempty"`
+}
+
+func createATConsoleHandler(db *gorm.DB, commands *commandPort, console *atConsole) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			// recent audit log
+			commands := []ATCommand{}
+			if err := db.Order("created_at desc").Limit(100).Find(&commands).Error; err != nil {
+				http.Error(w, "500 Failed to list.", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, commands)
+		case "POST":
+			var req struct {
+				Command string `json:"command"`
+			}
+			err := json.NewDecoder(r.Body).Decode(&req)
+			defer r.Body.Close()
+			if err != nil || req.Command == "" {
+				http.Error(w, "400 Bad request.", http.StatusBadRequest)
+				return
+			}
+
+			audit := ATCommand{
+				ID:         uuid.New().String(),
+				Command:    req.Command,
+				Permitted:  console.permitted(req.Command),
+				RemoteAddr: r.RemoteAddr,
+			}
+			if !audit.Permitted {
+				db.Create(&audit)
+				http.Error(w, "403 Command is not allowed.", http.StatusForbidden)
+				return
+			}
+
+			log.Printf("Running AT command for %v: %v\n", r.RemoteAddr, req.Command)
+			modemMutex.Lock()
+			lines, err := commands.run(req.Command)
+			modemMutex.Unlock()
+
+			result := atCommandResult{Command: req.Command, Lines: lines}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			audit.Response = strings.Join(lines, "\n")
+			audit.Error = result.Error
+			db.Create(&audit)
+
+			// an ERROR from the modem is still a response
+			if lines == nil && err != nil {
+				http.Error(w, "504 "+err.Error()+".", http.StatusGatewayTimeout)
+				return
+			}
+			writeJSON(w, http.StatusOK, result)
+		default:
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+	}
+}
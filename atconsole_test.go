@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestATConsole(t *testing.T) {
+	Convey("Checking console commands", t, func() {
+		Convey("with the default lists", func() {
+			console := newATConsole("", "")
+
+			Convey("should allow read only queries", func() {
+				So(console.permitted("AT+CSQ"), ShouldBeTrue)
+				So(console.permitted("at+cops?"), ShouldBeTrue)
+				So(console.permitted("AT+CREG?"), ShouldBeTrue)
+				So(console.permitted("AT+CPMS?"), ShouldBeTrue)
+				So(console.permitted("ATI"), ShouldBeTrue)
+			})
+
+			Convey("should refuse anything else", func() {
+				So(console.permitted("AT+CGMI"), ShouldBeFalse)
+				So(console.permitted("AT+COPS=0"), ShouldBeFalse)
+			})
+		})
+
+		Convey("allowing everything", func() {
+			console := newATConsole("AT", "")
+
+			Convey("should still deny commands which disturb the gateway", func() {
+				So(console.permitted("AT+CGMI"), ShouldBeTrue)
+				So(console.permitted("ATZ"), ShouldBeFalse)
+				So(console.permitted("ATE1"), ShouldBeFalse)
+				So(console.permitted("AT+CFUN=1,1"), ShouldBeFalse)
+				So(console.permitted("AT+CPMS=\"ME\""), ShouldBeFalse)
+			})
+
+			Convey("should deny calls, USSD, SIM locks and port settings", func() {
+				So(console.permitted("ATD+15555550100;"), ShouldBeFalse)
+				So(console.permitted("ATD+15555550100"), ShouldBeFalse)
+				So(console.permitted("AT+CUSD=1,\"*100#\""), ShouldBeFalse)
+				So(console.permitted("AT+CPIN=\"1234\""), ShouldBeFalse)
+				So(console.permitted("AT+CLCK=\"SC\",0,\"1234\""), ShouldBeFalse)
+				So(console.permitted("AT+CPWD=\"SC\",\"1234\",\"4321\""), ShouldBeFalse)
+				So(console.permitted("AT+IPR=9600"), ShouldBeFalse)
+				So(console.permitted("AT+CPOF"), ShouldBeFalse)
+				So(console.permitted("ATA"), ShouldBeFalse)
+				So(console.permitted("ATS0=1"), ShouldBeFalse)
+			})
+
+			Convey("should ignore spaces when matching denied commands", func() {
+				So(console.permitted("AT +CFUN=1,1"), ShouldBeFalse)
+				So(console.permitted("AT E0"), ShouldBeFalse)
+				So(console.permitted("AT+ CMGD=1,4"), ShouldBeFalse)
+				So(console.permitted(" at\t+cgmi"), ShouldBeTrue)
+			})
+
+			Convey("should deny chained and non AT commands", func() {
+				So(console.permitted("AT+CSQ;+CFUN=0"), ShouldBeFalse)
+				So(console.permitted("AT+CSQ\r\nATZ"), ShouldBeFalse)
+				So(console.permitted("hello"), ShouldBeFalse)
+			})
+		})
+
+		Convey("with an allow list", func() {
+			console := newATConsole("AT+CSQ,AT+COPS?", "")
+
+			So(console.permitted("AT+CSQ"), ShouldBeTrue)
+			So(console.permitted("AT+CREG?"), ShouldBeFalse)
+		})
+
+		Convey("with a deny list", func() {
+			console := newATConsole("AT", "AT+CGMI")
+
+			Convey("should deny it along with the defaults", func() {
+				So(console.permitted("AT+CGMI"), ShouldBeFalse)
+				So(console.permitted("ATZ"), ShouldBeFalse)
+				So(console.permitted("AT+CSQ"), ShouldBeTrue)
+			})
+		})
+	})
+}
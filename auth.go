@@ -0,0 +1,26 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// requireAdmin checks for the admin token as a bearer token.  Admin endpoints
+// are disabled when no token is configured.
+func requireAdmin(token string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.Error(w, "403 Admin api is disabled, set ADMIN_TOKEN.", http.StatusForbidden)
+			return
+		}
+
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			http.Error(w, "401 Unauthorized.", http.StatusUnauthorized)
+			return
+		}
+
+		handler(w, r)
+	}
+}
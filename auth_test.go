@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	request := func(token string, given string) int {
+		r := httptest.NewRequest("GET", "/api/suppressions", nil)
+		if given != "" {
+			r.Header.Set("Authorization", "Bearer "+given)
+		}
+		w := httptest.NewRecorder()
+		requireAdmin(token, ok)(w, r)
+		return w.Code
+	}
+
+	Convey("Checking the admin token", t, func() {
+		Convey("should allow the token", func() {
+			So(request("secret", "secret"), ShouldEqual, http.StatusOK)
+		})
+
+		Convey("should refuse a missing or wrong token", func() {
+			So(request("secret", ""), ShouldEqual, http.StatusUnauthorized)
+			So(request("secret", "guess"), ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("should refuse everything when no token is configured", func() {
+			So(request("", ""), ShouldEqual, http.StatusForbidden)
+			So(request("", "anything"), ShouldEqual, http.StatusForbidden)
+		})
+	})
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+const defaultAutoResponseCooldown = 3600
+
+// AutoResponse replies to matching inbound messages directly from the gateway.
+// ActiveFrom and ActiveTo are "15:04" times in TimeZone and may wrap past
+// midnight, eg 17:00 to 09:00 for out of hours.
+type AutoResponse struct {
+	ID         string    `gorm:"primary_key" json:"id"`
+	Priority   int       `gorm:"index" json:"priority"`
+	Keyword    string    `gorm:"size:32" json:"keyword"`
+	ActiveFrom string    `gorm:"size:5" json:"active_from"`
+	ActiveTo   string    `gorm:"size:5" json:"active_to"`
+	TimeZone   string    `gorm:"size:64" json:"time_zone"`
+	Body       string    `gorm:"size:160" json:"body"`
+	Cooldown   int       `json:"cooldown"`
+	Exclusive  bool      `json:"exclusive"`
+	CreatedAt  time.Time `json:"-"`
+	UpdatedAt  time.Time `json:"-"`
+}
+
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid time %q, expected HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (a *AutoResponse) validate() error {
+	if err := validateBody(a.Body); err != nil {
+		return err
+	}
+	if (a.ActiveFrom == "") != (a.ActiveTo == "") {
+		return fmt.Errorf("Both active_from and active_to are required for a time window")
+	}
+	if a.ActiveFrom != "" {
+		if _, err := parseClock(a.ActiveFrom); err != nil {
+			return err
+		}
+		if _, err := parseClock(a.ActiveTo); err != nil {
+			return err
+		}
+	}
+	if _, err := time.LoadLocation(a.TimeZone); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (a *AutoResponse) activeAt(t time.Time) bool {
+	if a.ActiveFrom == "" {
+		return true
+	}
+
+	location, err := time.LoadLocation(a.TimeZone)
+	if err != nil {
+		return false
+	}
+	from, fromErr := parseClock(a.ActiveFrom)
+	to, toErr := parseClock(a.ActiveTo)
+	if fromErr != nil || toErr != nil {
+		return false
+	}
+
+	local := t.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	if from <= to {
+		return minute >= from && minute < to
+	}
+	return minute >= from || minute < to
+}
+
+func (a *AutoResponse) matches(m *Message, t time.Time) bool {
+	if a.Keyword != "" && !matchesKeyword(m.Body, []string{strings.ToUpper(a.Keyword)}) {
+		return false
+	}
+	return a.activeAt(t)
+}
+
+func (a *AutoResponse) cooldown() time.Duration {
+	if a.Cooldown <= 0 {
+		return defaultAutoResponseCooldown * time.Second
+	}
+	return time.Duration(a.Cooldown) * time.Second
+}
+
+// autoRespond queues a reply from the first matching rule, returning whether
+// the rule replaces the webhook notification.
+func autoRespond(db *gorm.DB, m *Message) (bool, error) {
+	// never answer opt outs
+	if matchesKeyword(m.Body, optOutKeywords) {
+		return false, nil
+	}
+
+	var rules []AutoResponse
+	if err := db.Order("priority, created_at").Find(&rules).Error; err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.matches(m, now) {
+			continue
+		}
+
+		// avoid loops with other automated senders
+		var recent int
+		err := db.Model(&Message{}).
+			Where("auto_response_id = ? AND number = ? AND created_at >= ?", rule.ID, m.Number, now.Add(-rule.cooldown())).
+			Count(&recent).Error
+		if err != nil {
+			return false, err
+		}
+		if recent > 0 {
+			return rule.Exclusive, nil
+		}
+
+		reply := Message{Body: rule.Body, AutoResponseID: rule.ID}
+		return rule.Exclusive, enqueueReply(db, m, &reply, 0)
+	}
+
+	return false, nil
+}
+
+func createAutoResponsesHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			rules := []AutoResponse{}
+			if err := db.Order("priority, created_at").Find(&rules).Error; err != nil {
+				http.Error(w, "500 Failed to list.", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, rules)
+		case "POST":
+			decoder := json.NewDecoder(r.Body)
+			var rule AutoResponse
+			err := decoder.Decode(&rule)
+			defer r.Body.Close()
+			if err != nil {
+				http.Error(w, "400 Bad request.", http.StatusBadRequest)
+				return
+			}
+			if err := rule.validate(); err != nil {
+				http.Error(w, "400 "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			rule.ID = uuid.New().String()
+			if err := db.Create(&rule).Error; err != nil {
+				http.Error(w, "500 Failed to create.", http.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(w, http.StatusCreated, rule)
+		default:
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+	}
+}
+
+func createAutoResponseHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/autoresponses/")
+
+		var rule AutoResponse
+		if db.Where("id = ?", id).First(&rule).RecordNotFound() {
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			writeJSON(w, http.StatusOK, rule)
+		case "DELETE":
+			db.Delete(&rule)
+			writeJSON(w, http.StatusOK, rule)
+		default:
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAutoResponseActiveAt(t *testing.T) {
+	Convey("Checking an out of hours window", t, func() {
+		rule := AutoResponse{ActiveFrom: "17:00", ActiveTo: "09:00", TimeZone: "America/Vancouver"}
+		location, _ := time.LoadLocation("America/Vancouver")
+
+		Convey("should be active late in the evening", func() {
+			So(rule.activeAt(time.Date(2018, 4, 28, 22, 0, 0, 0, location)), ShouldBeTrue)
+		})
+
+		Convey("should be active early in the morning", func() {
+			So(rule.activeAt(time.Date(2018, 4, 28, 8, 59, 0, 0, location)), ShouldBeTrue)
+		})
+
+		Convey("should be inactive during the day", func() {
+			So(rule.activeAt(time.Date(2018, 4, 28, 12, 0, 0, 0, location)), ShouldBeFalse)
+		})
+	})
+}
+
+func TestAutoResponseValidate(t *testing.T) {
+	Convey("Validating an auto response", t, func() {
+		Convey("should accept a body the modem can send", func() {
+			So((&AutoResponse{Body: "We're closed"}).validate(), ShouldBeNil)
+		})
+
+		Convey("should reject a body too long for one message", func() {
+			So((&AutoResponse{Body: strings.Repeat("a", 161)}).validate(), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	CampaignRunning   = "running"
+	CampaignPaused    = "paused"
+	CampaignCancelled = "cancelled"
+)
+
+// Campaign sends a message to many recipients through the queue.  The body may
+// contain {{name}} placeholders filled from each recipient's variables.
+type Campaign struct {
+	ID        string         `gorm:"primary_key" json:"id"`
+	Name      string         `gorm:"size:64" json:"name"`
+	Body      string         `gorm:"size:255" json:"body"`
+	Status    string         `gorm:"size:16" json:"status"`
+	Total     int            `json:"total"`
+	Progress  map[string]int `gorm:"-" json:"progress"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"-"`
+}
+
+type campaignRecipient struct {
+	Number    string            `json:"number"`
+	Variables map[string]string `json:"variables"`
+}
+
+type campaignRequest struct {
+	Name       string              `json:"name"`
+	Body       string              `json:"body"`
+	TemplateID string              `json:"template_id"`
+	Recipients []campaignRecipient `json:"recipients"`
+}
+
+// readCSVRecipients reads a number column followed by variable columns named
+// by the header row
+func readCSVRecipients(r io.Reader) ([]campaignRecipient, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) < 2 {
+		return []campaignRecipient{}, nil
+	}
+
+	header := rows[0]
+	recipients := make([]campaignRecipient, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		recipient := campaignRecipient{Number: row[0], Variables: map[string]string{}}
+		for i := 1; i < len(row) && i < len(header); i++ {
+			recipient.Variables[strings.TrimSpace(header[i])] = row[i]
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
+
+// truncateString cuts s to at most length characters
+func truncateString(s string, length int) string {
+	count := 0
+	for i := range s {
+		if count == length {
+			return s[:i]
+		}
+		count++
+	}
+	return s
+}
+
+func loadProgress(db *gorm.DB, c *Campaign) error {
+	rows, err := db.Model(&Message{}).
+		Select("status, count(*)").
+		Where("campaign_id = ?", c.ID).
+		Group("status").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	c.Progress = map[string]int{}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return err
+		}
+		c.Progress[status] = count
+	}
+	return nil
+}
+
+// createCampaign queues a message per recipient.  Recipients which can't be
+// sent to are recorded with a failed or suppressed status.
+func createCampaign(db *gorm.DB, format *numberFormat, req *campaignRequest) (*Campaign, error) {
+	now := time.Now().UTC()
+	c := Campaign{
+		ID:     uuid.New().String(),
+		Name:   req.Name,
+		Body:   req.Body,
+		Status: CampaignRunning,
+		Total:  len(req.Recipients),
+	}
+
+	tx := db.Begin()
+	if err := tx.Create(&c).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	messages := []Message{}
+	for _, recipient := range req.Recipients {
+		m := Message{
+			ID:         uuid.New().String(),
+			Status:     StatusScheduled,
+			SendAt:     &now,
+			CampaignID: c.ID,
+			Time:       now,
+		}
+
+		number, numberErr := format.normalize(recipient.Number)
+		body, renderErr := renderPlaceholders(req.Body, recipient.Variables)
+		if renderErr == nil {
+			renderErr = validateBody(body)
+		}
+		if numberErr != nil || renderErr != nil {
+			// keep what was given, cut to fit the number column
+			m.Number = truncateString(recipient.Number, 32)
+			m.Status = StatusFailed
+			m.SendAt = nil
+		} else {
+			m.Number = number
+			m.Body = body
+
+			suppressed, err := isSuppressed(tx, number)
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			if suppressed {
+				m.Status = StatusSuppressed
+				m.SendAt = nil
+			}
+		}
+
+		if err := tx.Create(&m).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	for i := range messages {
+		publishMessage(&messages[i])
+	}
+	return &c, loadProgress(db, &c)
+}
+
+// setCampaignStatus pauses, resumes or cancels the campaign's queued messages
+func setCampaignStatus(db *gorm.DB, c *Campaign, status string) error {
+	var from []string
+	update := map[string]interface{}{}
+	switch status {
+	case CampaignPaused:
+		from = queuedStatuses
+		update["status"] = StatusPaused
+	case CampaignRunning:
+		from = []string{StatusPaused}
+		update["status"] = StatusScheduled
+		update["send_at"] = time.Now().UTC()
+	case CampaignCancelled:
+		from = []string{StatusScheduled, StatusDelayed, StatusPaused}
+		update["status"] = StatusCancelled
+	}
+
+	// updated_at is set by gorm in local time, and finds the changed
+	// messages to announce once committed
+	changedAt := time.Now()
+	tx := db.Begin()
+	err := tx.Model(&Message{}).Where("campaign_id = ? AND status IN (?)", c.ID, from).Updates(update).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	c.Status = status
+	if err := tx.Save(c).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	var changed []Message
+	err = db.Where("campaign_id = ? AND status = ? AND updated_at >= ?", c.ID, update["status"], changedAt).Find(&changed).Error
+	if err != nil {
+		return err
+	}
+	for i := range changed {
+		publishMessage(&changed[i])
+	}
+	return nil
+}
+
+func createCampaignsHandler(db *gorm.DB, format *numberFormat) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			campaigns := []Campaign{}
+			if err := db.Order("created_at").Find(&campaigns).Error; err != nil {
+				http.Error(w, "500 Failed to list.", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, campaigns)
+		case "POST":
+			defer r.Body.Close()
+
+			// recipients are either json or an uploaded csv
+			var req campaignRequest
+			var err error
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+				req.Name = r.URL.Query().Get("name")
+				req.Body = r.URL.Query().Get("body")
+				req.TemplateID = r.URL.Query().Get("template_id")
+				req.Recipients, err = readCSVRecipients(r.Body)
+			} else {
+				err = json.NewDecoder(r.Body).Decode(&req)
+			}
+			if err != nil || (req.Body == "" && req.TemplateID == "") || len(req.Recipients) == 0 {
+				http.Error(w, "400 Bad request.", http.StatusBadRequest)
+				return
+			}
+
+			// recipients' variables are filled into the template
+			if req.TemplateID != "" {
+				var t Template
+				if db.Where("id = ? OR name = ?", req.TemplateID, req.TemplateID).First(&t).RecordNotFound() {
+					http.Error(w, "400 Template not found.", http.StatusBadRequest)
+					return
+				}
+				req.Body = t.Body
+			}
+
+			c, err := createCampaign(db, format, &req)
+			if err != nil {
+				http.Error(w, "500 Failed to create.", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusCreated, c)
+		default:
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+	}
+}
+
+func createCampaignHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// /api/campaigns/{id} or /api/campaigns/{id}/{action}
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/api/campaigns/"), "/", 2)
+
+		var c Campaign
+		if db.Where("id = ?", parts[0]).First(&c).RecordNotFound() {
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+
+		if len(parts) == 1 && r.Method == "GET" {
+			if err := loadProgress(db, &c); err != nil {
+				http.Error(w, "500 Failed to load.", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, c)
+			return
+		}
+		if len(parts) != 2 || r.Method != "POST" {
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+
+		var status string
+		switch parts[1] {
+		case "pause":
+			status = CampaignPaused
+		case "resume":
+			status = CampaignRunning
+		case "cancel":
+			status = CampaignCancelled
+		default:
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+		if c.Status == CampaignCancelled {
+			http.Error(w, "409 Campaign is cancelled.", http.StatusConflict)
+			return
+		}
+
+		if err := setCampaignStatus(db, &c, status); err != nil {
+			http.Error(w, "500 Failed to update.", http.StatusInternalServerError)
+			return
+		}
+		if err := loadProgress(db, &c); err != nil {
+			http.Error(w, "500 Failed to load.", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, c)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCreateCampaign(t *testing.T) {
+	Convey("Creating a campaign", t, func() {
+		db, err := newTestDB()
+		So(err, ShouldBeNil)
+		defer db.Close()
+
+		format := newNumberFormat("1", "1", "011")
+		req := campaignRequest{
+			Name: "hours",
+			Body: "Hi {{name}}, we're open late tonight",
+			Recipients: []campaignRecipient{
+				{Number: "5555550100", Variables: map[string]string{"name": "Sam"}},
+				{Number: "555", Variables: map[string]string{"name": "Alex"}},
+			},
+		}
+
+		Convey("should queue a message per recipient", func() {
+			c, err := createCampaign(db, format, &req)
+			So(err, ShouldBeNil)
+			So(c.Progress[StatusScheduled], ShouldEqual, 1)
+			So(c.Progress[StatusFailed], ShouldEqual, 1)
+		})
+
+		Convey("should record a recipient too long for a number as failed", func() {
+			req.Recipients = append(req.Recipients, campaignRecipient{Number: strings.Repeat("5", 40)})
+
+			c, err := createCampaign(db, format, &req)
+			So(err, ShouldBeNil)
+			So(c.Progress[StatusFailed], ShouldEqual, 2)
+
+			var m Message
+			So(db.Where("campaign_id = ? AND number LIKE ?", c.ID, "55555555555555555%").First(&m).Error, ShouldBeNil)
+			So(m.Number, ShouldEqual, strings.Repeat("5", 32))
+		})
+
+		Convey("should store nothing when a message can't be stored", func() {
+			failInserts(db, "messages")
+
+			_, err := createCampaign(db, format, &req)
+			So(err, ShouldNotBeNil)
+
+			var count int
+			db.Model(&Campaign{}).Count(&count)
+			So(count, ShouldEqual, 0)
+		})
+	})
+}
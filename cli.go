@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const commandUsage = `usage: gsm-gateway [command] [arguments]
+
+With no command, or serve, runs the gateway.  Other commands talk to a running
+gateway at GATEWAY_URL (default http://localhost:$PORT) using GATEWAY_TOKEN or
+ADMIN_TOKEN as the bearer token:
+
+  send [-at time] [-template id] [-var name=value] number [body]
+  list [-status status] [-conversation id] [-campaign id]
+  get id
+  status
+  queue [cancel id]
+  at command
+
+keys manages api keys directly in the database, using the PG* variables:
+
+  keys [list]
+  keys create name
+  keys revoke id
+`
+
+var errUsage = errors.New("usage")
+
+// runCommand runs a client command, returning the exit code
+func runCommand(name string, args []string) int {
+	var err error
+	switch name {
+	case "help", "-h", "-help", "--help":
+		fmt.Print(commandUsage)
+		return 0
+	case "keys":
+		err = runKeysCommand(os.Stdout, args)
+	default:
+		client := &apiClient{
+			url:   strings.TrimSuffix(envOrDefault("GATEWAY_URL", "http://localhost:"+envOrDefault("PORT", "8080")), "/"),
+			token: envOrDefault("GATEWAY_TOKEN", os.Getenv("ADMIN_TOKEN")),
+		}
+		err = client.run(os.Stdout, name, args)
+	}
+
+	if err == errUsage {
+		fmt.Fprint(os.Stderr, commandUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	return 0
+}
+
+// apiClient calls the http api of a running gateway
+type apiClient struct {
+	url   string
+	token string
+}
+
+func (c *apiClient) request(method string, path string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		str, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(str)
+	}
+
+	req, err := http.NewRequest(method, c.url+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// errors from the api are plain text, eg 400 Bad request.
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		text, _ := ioutil.ReadAll(res.Body)
+		return errors.New(strings.TrimSpace(string(text)))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(result)
+}
+
+// variablesFlag collects repeated -var name=value flags
+type variablesFlag map[string]string
+
+func (v variablesFlag) String() string {
+	return fmt.Sprint(map[string]string(v))
+}
+
+func (v variablesFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return errors.New("variables should be name=value")
+	}
+	v[parts[0]] = parts[1]
+	return nil
+}
+
+func (c *apiClient) run(w io.Writer, name string, args []string) error {
+	switch name {
+	case "send":
+		flags := flag.NewFlagSet("send", flag.ContinueOnError)
+		at := flags.String("at", "", "send at this RFC 3339 time")
+		template := flags.String("template", "", "template id")
+		variables := variablesFlag{}
+		flags.Var(variables, "var", "template variable as name=value")
+		if flags.Parse(args) != nil || flags.NArg() < 1 {
+			return errUsage
+		}
+
+		body := map[string]interface{}{
+			"number": flags.Arg(0),
+			"body":   strings.Join(flags.Args()[1:], " "),
+		}
+		if *template != "" {
+			body["template_id"] = *template
+			body["variables"] = variables
+		}
+		if *at != "" {
+			sendAt, err := time.Parse(time.RFC3339, *at)
+			if err != nil {
+				return err
+			}
+			body["send_at"] = sendAt
+		}
+
+		var m Message
+		if err := c.request("POST", "/api/messages", body, &m); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%v %v %v\n", m.ID, m.Status, m.Number)
+		return nil
+	case "list":
+		flags := flag.NewFlagSet("list", flag.ContinueOnError)
+		status := flags.String("status", "", "only messages with this status")
+		conversation := flags.String("conversation", "", "both sides of a conversation")
+		campaign := flags.String("campaign", "", "only messages in this campaign")
+		if flags.Parse(args) != nil || flags.NArg() != 0 {
+			return errUsage
+		}
+
+		query := url.Values{}
+		for key, value := range map[string]string{"status": *status, "conversation_id": *conversation, "campaign_id": *campaign} {
+			if value != "" {
+				query.Set(key, value)
+			}
+		}
+
+		var messages []Message
+		if err := c.request("GET", "/api/messages?"+query.Encode(), nil, &messages); err != nil {
+			return err
+		}
+		printMessages(w, messages)
+		return nil
+	case "get":
+		if len(args) != 1 {
+			return errUsage
+		}
+
+		var m map[string]interface{}
+		if err := c.request("GET", "/api/messages/"+args[0], nil, &m); err != nil {
+			return err
+		}
+		str, _ := json.MarshalIndent(m, "", "  ")
+		fmt.Fprintln(w, string(str))
+		return nil
+	case "status":
+		if len(args) != 0 {
+			return errUsage
+		}
+
+		var status gatewayStatus
+		if err := c.request("GET", "/api/status", nil, &status); err != nil {
+			return err
+		}
+		printStatus(w, status)
+		return nil
+	case "queue":
+		if len(args) == 2 && args[0] == "cancel" {
+			var m Message
+			if err := c.request("DELETE", "/api/messages/"+args[1], nil, &m); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%v %v\n", m.ID, m.Status)
+			return nil
+		}
+		if len(args) != 0 {
+			return errUsage
+		}
+
+		queued := []Message{}
+		for _, status := range []string{StatusScheduled, StatusDelayed} {
+			var messages []Message
+			if err := c.request("GET", "/api/messages?status="+status, nil, &messages); err != nil {
+				return err
+			}
+			queued = append(queued, messages...)
+		}
+		sort.Slice(queued, func(i, j int) bool {
+			return queued[i].SendAt != nil && (queued[j].SendAt == nil || queued[i].SendAt.Before(*queued[j].SendAt))
+		})
+		printMessages(w, queued)
+		return nil
+	case "at":
+		if len(args) == 0 {
+			return errUsage
+		}
+
+		var result atCommandResult
+		if err := c.request("POST", "/api/modem/at", map[string]string{"command": strings.Join(args, " ")}, &result); err != nil {
+			return err
+		}
+		for _, line := range result.Lines {
+			fmt.Fprintln(w, line)
+		}
+		if result.Error != "" {
+			return errors.New(result.Error)
+		}
+		return nil
+	}
+
+	return errUsage
+}
+
+func printMessages(w io.Writer, messages []Message) {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tNUMBER\tSTATUS\tTIME\tSEND AT\tBODY")
+	for _, m := range messages {
+		sendAt := ""
+		if m.SendAt != nil {
+			sendAt = m.SendAt.Format(time.RFC3339)
+		}
+		body := strings.Replace(m.Body, "\n", " ", -1)
+		fmt.Fprintf(table, "%v\t%v\t%v\t%v\t%v\t%v\n", m.ID, m.Number, m.Status, m.Time.Format(time.RFC3339), sendAt, body)
+	}
+	table.Flush()
+}
+
+func printStatus(w io.Writer, status gatewayStatus) {
+	statuses := []string{}
+	for s := range status.Queue {
+		statuses = append(statuses, s)
+	}
+	sort.Strings(statuses)
+	counts := []string{}
+	for _, s := range statuses {
+		counts = append(counts, fmt.Sprintf("%v %v", s, status.Queue[s]))
+	}
+
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(table, "Modem:\t%v\n", status.Modem.Modem)
+	fmt.Fprintf(table, "Service:\t%v\n", status.Modem.Service)
+	fmt.Fprintf(table, "Network:\t%v\n", status.Modem.Network)
+	fmt.Fprintf(table, "Updated:\t%v\n", status.Modem.UpdatedAt.Format(time.RFC3339))
+	if status.Modem.SignalDBM != nil {
+		fmt.Fprintf(table, "Signal:\t%v dBm\n", *status.Modem.SignalDBM)
+	} else {
+		fmt.Fprintf(table, "Signal:\tunknown\n")
+	}
+	fmt.Fprintf(table, "Storage:\t%v/%v\n", status.Modem.StorageUsed, status.Modem.StorageTotal)
+	fmt.Fprintf(table, "Messages:\t%v\n", strings.Join(counts, ", "))
+	table.Flush()
+}
+
+func runKeysCommand(w io.Writer, args []string) error {
+	command := "list"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	db, err := gorm.Open("postgres", pgConnectionString())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	db.AutoMigrate(&APIKey{})
+
+	switch {
+	case command == "list" && len(args) <= 1:
+		var keys []APIKey
+		if err := db.Order("created_at").Find(&keys).Error; err != nil {
+			return err
+		}
+
+		table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(table, "ID\tNAME\tPREFIX\tCREATED\tLAST USED")
+		for _, key := range keys {
+			lastUsed := "never"
+			if key.LastUsedAt != nil {
+				lastUsed = key.LastUsedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(table, "%v\t%v\t%v\t%v\t%v\n", key.ID, key.Name, key.Prefix, key.CreatedAt.Format(time.RFC3339), lastUsed)
+		}
+		table.Flush()
+		return nil
+	case command == "create" && len(args) == 2:
+		apiKey, key, err := createAPIKey(db, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Created key %v for %v.  It can't be shown again:\n%v\n", apiKey.ID, apiKey.Name, key)
+		return nil
+	case command == "revoke" && len(args) == 2:
+		deleted := db.Where("id = ?", args[1]).Delete(&APIKey{})
+		if deleted.Error != nil {
+			return deleted.Error
+		}
+		if deleted.RowsAffected == 0 {
+			return fmt.Errorf("No key %v", args[1])
+		}
+		fmt.Fprintf(w, "Revoked key %v\n", args[1])
+		return nil
+	}
+
+	return errUsage
+}
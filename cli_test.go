@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCommands(t *testing.T) {
+	Convey("Running client commands", t, func() {
+		var received map[string]interface{}
+		var authorization string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+			switch {
+			case r.Method == "POST" && r.URL.Path == "/api/messages":
+				json.NewDecoder(r.Body).Decode(&received)
+				writeJSON(w, http.StatusOK, Message{ID: "abc", Number: "+15555555555", Status: StatusSent})
+			case r.Method == "GET" && r.URL.Path == "/api/messages":
+				writeJSON(w, http.StatusOK, []Message{{ID: "abc", Number: "+15555555555", Status: r.URL.Query().Get("status"), Body: "hello"}})
+			default:
+				http.Error(w, "404 not found.", http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		client := &apiClient{url: server.URL, token: "secret"}
+		var out bytes.Buffer
+
+		Convey("send should post the number and body", func() {
+			err := client.run(&out, "send", []string{"5555555555", "hello", "there"})
+			So(err, ShouldBeNil)
+			So(received["number"], ShouldEqual, "5555555555")
+			So(received["body"], ShouldEqual, "hello there")
+			So(authorization, ShouldEqual, "Bearer secret")
+			So(out.String(), ShouldEqual, "abc sent +15555555555\n")
+		})
+
+		Convey("send should pass template variables", func() {
+			err := client.run(&out, "send", []string{"-template", "t1", "-var", "name=Ann", "5555555555"})
+			So(err, ShouldBeNil)
+			So(received["template_id"], ShouldEqual, "t1")
+			So(received["variables"], ShouldResemble, map[string]interface{}{"name": "Ann"})
+		})
+
+		Convey("list should print a table", func() {
+			err := client.run(&out, "list", []string{"-status", "failed"})
+			So(err, ShouldBeNil)
+			So(out.String(), ShouldContainSubstring, "ID")
+			So(out.String(), ShouldContainSubstring, "failed")
+			So(out.String(), ShouldContainSubstring, "hello")
+		})
+
+		Convey("api errors should be returned", func() {
+			err := client.run(&out, "get", []string{"missing"})
+			So(err.Error(), ShouldEqual, "404 not found.")
+		})
+
+		Convey("bad arguments should be a usage error", func() {
+			So(client.run(&out, "send", []string{}), ShouldEqual, errUsage)
+			So(client.run(&out, "unknown", []string{}), ShouldEqual, errUsage)
+		})
+	})
+}
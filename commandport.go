@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// commandTimeout matches gogsmmodem's wait for a response
+const commandTimeout = 4 * time.Second
+
+// unsolicitedPrefixes are notifications gogsmmodem handles, which are passed
+// on to it even while a raw command is running
+var unsolicitedPrefixes = []string{"+CMTI:", "+ZPASR:", "+ZDONR:", "+ZUSIMR:"}
+
+// commandPort sits between the serial port and gogsmmodem so the gateway can
+// run commands gogsmmodem has no method for.  While a raw command is running
+// its response is taken out of what gogsmmodem reads, up to the final result
+// code, so gogsmmodem never sees a response it isn't waiting for.  Callers
+// hold modemMutex, so gogsmmodem has no command of its own in progress.
+type commandPort struct {
+	port io.ReadWriteCloser
+
+	mutex   sync.Mutex
+	running bool
+	command string
+	partial []byte
+	lines   []string
+	result  chan []string
+	out     []byte
+}
+
+func newCommandPort(port io.ReadWriteCloser) *commandPort {
+	return &commandPort{port: port}
+}
+
+func (p *commandPort) Read(b []byte) (int, error) {
+	buffer := make([]byte, len(b))
+	for {
+		p.mutex.Lock()
+		if len(p.out) > 0 {
+			n := copy(b, p.out)
+			p.out = p.out[n:]
+			p.mutex.Unlock()
+			return n, nil
+		}
+		p.mutex.Unlock()
+
+		// keep reading while a raw response is all that arrives, a reader
+		// given nothing may give up
+		n, err := p.port.Read(buffer)
+		if n > 0 {
+			p.received(buffer[:n])
+		}
+		if err != nil {
+			p.mutex.Lock()
+			pending := len(p.out)
+			p.mutex.Unlock()
+			if pending == 0 {
+				return 0, err
+			}
+		}
+	}
+}
+
+// Write passes on gogsmmodem's commands.  A raw command which timed out stops
+// collecting its response, as the next response belongs to gogsmmodem.
+func (p *commandPort) Write(b []byte) (int, error) {
+	p.mutex.Lock()
+	p.stop()
+	p.mutex.Unlock()
+	return p.port.Write(b)
+}
+
+func (p *commandPort) Close() error {
+	return p.port.Close()
+}
+
+// stop leaves raw mode, passing on anything left over.  Callers hold the mutex.
+func (p *commandPort) stop() {
+	p.running = false
+	p.out = append(p.out, p.partial...)
+	p.partial = nil
+}
+
+// received sorts data from the modem into the raw response or what gogsmmodem
+// reads
+func (p *commandPort) received(data []byte) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.running {
+		p.out = append(p.out, data...)
+		return
+	}
+
+	p.partial = append(p.partial, data...)
+	for p.running {
+		end := strings.IndexByte(string(p.partial), '\n')
+		if end < 0 {
+			return
+		}
+		raw := p.partial[:end+1]
+		p.partial = p.partial[end+1:]
+
+		line := strings.TrimRight(string(raw), "\r\n")
+		switch {
+		case line == "" || line == p.command:
+			// blank lines and the echo
+		case p.unsolicited(line):
+			p.out = append(p.out, raw...)
+		case isFinalResult(line):
+			p.lines = append(p.lines, line)
+			// the caller may have timed out
+			select {
+			case p.result <- p.lines:
+			default:
+			}
+			p.stop()
+		default:
+			p.lines = append(p.lines, line)
+		}
+	}
+}
+
+// unsolicited is true for notifications, unless they are the response to
+// the command itself, say +CREG to AT+CREG?
+func (p *commandPort) unsolicited(line string) bool {
+	for _, prefix := range unsolicitedPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return !strings.HasPrefix(p.command, "AT"+strings.TrimSuffix(prefix, ":"))
+		}
+	}
+	return false
+}
+
+// isFinalResult is true for the result codes which end a response
+func isFinalResult(line string) bool {
+	return line == "OK" || line == "ERROR" || strings.HasPrefix(line, "+CME ERROR") || strings.HasPrefix(line, "+CMS ERROR")
+}
+
+// run sends a command line, eg "AT+CSQ", and returns the response lines up to
+// and including the final result code.  Callers hold modemMutex.
+func (p *commandPort) run(command string) ([]string, error) {
+	command = strings.TrimRight(command, "\r\n")
+	result := make(chan []string, 1)
+
+	p.mutex.Lock()
+	p.stop()
+	p.running = true
+	p.command = command
+	p.lines = nil
+	p.result = result
+	p.mutex.Unlock()
+
+	if _, err := p.port.Write([]byte(command + "\r\n")); err != nil {
+		p.mutex.Lock()
+		p.stop()
+		p.mutex.Unlock()
+		return nil, err
+	}
+
+	select {
+	case lines := <-result:
+		if last := lines[len(lines)-1]; last != "OK" {
+			return lines, fmt.Errorf("Response was %v", last)
+		}
+		return lines, nil
+	case <-time.After(commandTimeout):
+		return nil, fmt.Errorf("Timed out waiting for response to %v", command)
+	}
+}
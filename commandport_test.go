@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/barnybug/gogsmmodem"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCommandPort(t *testing.T) {
+	Convey("Running raw commands", t, func() {
+		h, err := newReplayHarness("", "init", "commands")
+		So(err, ShouldBeNil)
+		defer h.close()
+
+		lines, err := h.commands.run("AT+CSQ")
+		So(err, ShouldBeNil)
+		So(lines, ShouldResemble, []string{"+CSQ: 20,99", "OK"})
+
+		Convey("should pass notifications on to the modem", func() {
+			select {
+			case p := <-h.modem.OOB:
+				So(p, ShouldResemble, gogsmmodem.ServiceStatus{Status: "UMTS"})
+			case <-time.After(time.Second):
+				So("no notification", ShouldBeNil)
+			}
+		})
+
+		Convey("should return error responses", func() {
+			lines, err := h.commands.run("AT+CLAC=?")
+			So(err, ShouldNotBeNil)
+			So(lines, ShouldResemble, []string{"+CME ERROR: 4"})
+
+			Convey("and leave the modem's own commands working", func() {
+				So(h.modem.DeleteMessage(1), ShouldBeNil)
+				So(h.done(), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCron(t *testing.T) {
+	Convey("Parsing cron expressions", t, func() {
+		Convey("should reject the wrong number of fields", func() {
+			_, err := parseCron("0 9 * *")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("should reject out of range values", func() {
+			_, err := parseCron("0 24 * * *")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Finding the next occurrence", t, func() {
+		location, _ := time.LoadLocation("America/Vancouver")
+		start := time.Date(2018, 4, 28, 10, 30, 0, 0, location)
+
+		Convey("should find the next weekly occurrence in the schedule's time zone", func() {
+			cron, _ := parseCron("0 9 * * 1")
+			next := cron.Next(start)
+			So(next.Format(time.RFC3339), ShouldEqual, "2018-04-30T09:00:00-07:00")
+		})
+
+		Convey("should handle steps and ranges", func() {
+			cron, _ := parseCron("*/15 9-17 * * *")
+			next := cron.Next(start)
+			So(next.Format(time.RFC3339), ShouldEqual, "2018-04-28T10:45:00-07:00")
+		})
+
+		Convey("should match either day of month or day of week when both are set", func() {
+			cron, _ := parseCron("0 0 1 * 0")
+			next := cron.Next(start)
+			So(next.Format(time.RFC3339), ShouldEqual, "2018-04-29T00:00:00-07:00")
+		})
+
+		Convey("should treat 7 as sunday", func() {
+			cron, _ := parseCron("0 0 * * 7")
+			next := cron.Next(start)
+			So(next.Weekday(), ShouldEqual, time.Sunday)
+		})
+	})
+
+	Convey("Advancing a schedule when clocks fall back", t, func() {
+		// 1:30 happens twice in New York on 2018-11-04
+		fired := time.Date(2018, 11, 4, 5, 30, 0, 0, time.UTC)
+		s := Schedule{Cron: "30 1 * * *", TimeZone: "America/New_York", LastRunAt: &fired}
+
+		Convey("should fire the repeated time once", func() {
+			So(s.advance(fired.Add(time.Minute)), ShouldBeNil)
+			So(s.NextRunAt.Format(time.RFC3339), ShouldEqual, "2018-11-05T06:30:00Z")
+		})
+
+		Convey("should fire each repeated time once when it fires several times an hour", func() {
+			s := Schedule{Cron: "*/15 1 * * *", TimeZone: "America/New_York"}
+			So(s.advance(time.Date(2018, 11, 4, 5, 0, 0, 0, time.UTC)), ShouldBeNil)
+			So(s.NextRunAt.Format(time.RFC3339), ShouldEqual, "2018-11-04T05:15:00Z")
+
+			// 1:45 is followed by the repeated 1:00, which is skipped
+			So(s.advance(time.Date(2018, 11, 4, 5, 45, 0, 0, time.UTC)), ShouldBeNil)
+			So(s.NextRunAt.Format(time.RFC3339), ShouldEqual, "2018-11-05T06:00:00Z")
+		})
+	})
+}
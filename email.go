@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// emailMaxBytes limits the size of emails accepted for sending
+const emailMaxBytes = 1 << 20
+
+type emailConfig struct {
+	// email to sms
+	port            string
+	domain          string
+	allowedNetworks []string
+	allowedSenders  []string
+	bodyMode        string
+
+	// sms to email
+	relay    string
+	username string
+	password string
+	from     string
+	forward  string
+}
+
+// allowed checks a sender against the allowlist of addresses and @domains
+func (c *emailConfig) allowed(sender string) bool {
+	sender = strings.ToLower(sender)
+	for _, allowed := range c.allowedSenders {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == sender || (strings.HasPrefix(allowed, "@") && strings.HasSuffix(sender, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedClient checks a connection's address against the allowlist of
+// networks and addresses, as the sender address can be anything
+func (c *emailConfig) allowedClient(addr net.Addr) bool {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, allowed := range c.allowedNetworks {
+		allowed = strings.TrimSpace(allowed)
+		if _, network, err := net.ParseCIDR(allowed); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(allowed); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// numberFromRecipient returns the number from <number>@domain
+func (c *emailConfig) numberFromRecipient(recipient string) (string, bool) {
+	at := strings.LastIndex(recipient, "@")
+	if at < 0 || !strings.EqualFold(recipient[at+1:], c.domain) {
+		return "", false
+	}
+	return recipient[:at], true
+}
+
+func parseAddress(arg string, prefix string) (string, error) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", fmt.Errorf("Expected %v", prefix)
+	}
+	address, err := mail.ParseAddress(strings.TrimSpace(arg[len(prefix):]))
+	if err != nil {
+		return "", err
+	}
+	return address.Address, nil
+}
+
+// decodeTransferEncoding undoes a Content-Transfer-Encoding.  multipart
+// readers already decode quoted-printable parts and drop the header.
+func decodeTransferEncoding(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	}
+	return body
+}
+
+// plainText returns the first text/plain part of an email body
+func plainText(header mail.Header, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		text, err := ioutil.ReadAll(decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body))
+		return string(text), err
+	}
+
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain") {
+			text, err := ioutil.ReadAll(decodeTransferEncoding(part.Header.Get("Content-Transfer-Encoding"), part))
+			return string(text), err
+		}
+	}
+}
+
+// emailToSMS builds the sms body from an email according to the body mode
+func emailToSMS(data []byte, mode string) (string, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	if mode == "subject" {
+		return truncateBody(strings.TrimSpace(subject), maxBodyLength), nil
+	}
+
+	text, err := plainText(msg.Header, msg.Body)
+	if err != nil {
+		return "", err
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if mode == "body" || subject == "" {
+		return truncateBody(text, maxBodyLength), nil
+	}
+	return truncateBody(strings.TrimSpace(subject+": "+text), maxBodyLength), nil
+}
+
+func serveSMTP(db *gorm.DB, format *numberFormat, config *emailConfig, conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	reply := func(code int, text string) {
+		tp.PrintfLine("%d %s", code, text)
+	}
+
+	if !config.allowedClient(conn.RemoteAddr()) {
+		log.Printf("Refused email connection from %v\n", conn.RemoteAddr())
+		reply(554, "Not accepting mail from this address")
+		return
+	}
+
+	var sender string
+	var recipients []string
+	reply(220, config.domain+" gsm-gateway ESMTP")
+
+	for {
+		conn.SetDeadline(time.Now().Add(5 * time.Minute))
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		parts := strings.SplitN(line, " ", 2)
+		command := strings.ToUpper(parts[0])
+		arg := ""
+		if len(parts) == 2 {
+			arg = parts[1]
+		}
+
+		switch command {
+		case "HELO", "EHLO":
+			reply(250, config.domain)
+		case "MAIL":
+			sender, err = parseAddress(arg, "FROM:")
+			if err != nil {
+				reply(501, "Bad sender address")
+			} else if !config.allowed(sender) {
+				log.Printf("Refused email from %v\n", sender)
+				reply(550, "Sender not allowed")
+				sender = ""
+			} else {
+				recipients = nil
+				reply(250, "OK")
+			}
+		case "RCPT":
+			recipient, err := parseAddress(arg, "TO:")
+			if err != nil {
+				reply(501, "Bad recipient address")
+			} else if sender == "" {
+				reply(503, "MAIL first")
+			} else if number, ok := config.numberFromRecipient(recipient); !ok {
+				reply(550, "Relaying denied")
+			} else {
+				recipients = append(recipients, number)
+				reply(250, "OK")
+			}
+		case "DATA":
+			if len(recipients) == 0 {
+				reply(503, "RCPT first")
+				continue
+			}
+			reply(354, "End data with <CR><LF>.<CR><LF>")
+			dot := tp.DotReader()
+			data, err := ioutil.ReadAll(io.LimitReader(dot, emailMaxBytes+1))
+			if err != nil {
+				return
+			}
+			if len(data) > emailMaxBytes {
+				if _, err := io.Copy(ioutil.Discard, dot); err != nil {
+					return
+				}
+				reply(552, "Message too large")
+				sender, recipients = "", nil
+				continue
+			}
+
+			body, err := emailToSMS(data, config.bodyMode)
+			if err != nil {
+				reply(554, "Could not read message")
+				continue
+			}
+
+			var failed []string
+			for _, number := range recipients {
+				m := Message{Number: number, Body: body}
+				if err := enqueueMessage(db, format, &m); err != nil {
+					log.Printf("Rejected email from %v to %v: %v\n", sender, number, err)
+					failed = append(failed, number)
+				}
+			}
+			if len(failed) == len(recipients) {
+				reply(554, "Could not send to "+strings.Join(failed, ", "))
+			} else {
+				reply(250, "Queued")
+			}
+			sender, recipients = "", nil
+		case "RSET":
+			sender, recipients = "", nil
+			reply(250, "OK")
+		case "NOOP":
+			reply(250, "OK")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			reply(502, "Command not implemented")
+		}
+	}
+}
+
+func forwardToEmail(config *emailConfig, m *Message) error {
+	var auth smtp.Auth
+	if config.username != "" {
+		host, _, _ := net.SplitHostPort(config.relay)
+		auth = smtp.PlainAuth("", config.username, config.password, host)
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %v\r\n", config.from)
+	fmt.Fprintf(&body, "To: %v\r\n", config.forward)
+	fmt.Fprintf(&body, "Subject: %v\r\n", mime.QEncoding.Encode("utf-8", "SMS from "+m.Number))
+	fmt.Fprintf(&body, "Date: %v\r\n", m.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&body, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&body, "%v\r\n", m.Body)
+
+	return smtp.SendMail(config.relay, auth, config.from, strings.Split(config.forward, ","), body.Bytes())
+}
+
+func listenOnEmail(db *gorm.DB, format *numberFormat, config *emailConfig) chan error {
+	errorChannel := make(chan error, 1)
+
+	if config.port != "" {
+		go func() {
+			for {
+				listener, err := net.Listen("tcp", ":"+config.port)
+				if err != nil {
+					errorChannel <- err
+					time.Sleep(5 * time.Second)
+					continue
+				}
+
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						errorChannel <- err
+						break
+					}
+					go serveSMTP(db, format, config, conn)
+				}
+				listener.Close()
+			}
+		}()
+	}
+
+	if config.relay != "" && config.forward != "" {
+		go events.follow(0, eventTypes(EventInbound), nil, func(e Event) error {
+			m, ok := e.Data.(Message)
+			if !ok {
+				return nil
+			}
+			if err := forwardToEmail(config, &m); err != nil {
+				errorChannel <- err
+			}
+			return nil
+		})
+	}
+
+	return errorChannel
+}
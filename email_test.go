@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/textproto"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEmailToSMS(t *testing.T) {
+	Convey("Converting email", t, func() {
+		email := []byte("From: monitor@example.com\r\n" +
+			"To: 15555555555@sms.local\r\n" +
+			"Subject: Disk full\r\n" +
+			"Content-Type: multipart/alternative; boundary=b\r\n" +
+			"\r\n" +
+			"--b\r\n" +
+			"Content-Type: text/plain\r\n" +
+			"\r\n" +
+			"/var is at\r\n  98%\r\n" +
+			"--b\r\n" +
+			"Content-Type: text/html\r\n" +
+			"\r\n" +
+			"<p>/var is at 98%</p>\r\n" +
+			"--b--\r\n")
+
+		Convey("should use the subject and plain text body", func() {
+			body, err := emailToSMS(email, "both")
+			So(err, ShouldBeNil)
+			So(body, ShouldEqual, "Disk full: /var is at 98%")
+		})
+
+		Convey("should use only the subject", func() {
+			body, err := emailToSMS(email, "subject")
+			So(err, ShouldBeNil)
+			So(body, ShouldEqual, "Disk full")
+		})
+
+		Convey("should decode a quoted-printable body", func() {
+			email := []byte("Subject: Disk full\r\n" +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"Content-Transfer-Encoding: quoted-printable\r\n" +
+				"\r\n" +
+				"/var is at 98%=\r\n =3D 49GB =E2=82=AC\r\n")
+			body, err := emailToSMS(email, "body")
+			So(err, ShouldBeNil)
+			So(body, ShouldEqual, "/var is at 98% = 49GB €")
+		})
+
+		Convey("should decode a base64 body", func() {
+			email := []byte("Subject: Disk full\r\n" +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"Content-Transfer-Encoding: base64\r\n" +
+				"\r\n" +
+				"L3ZhciBpcyBh\r\ndCA5OCU=\r\n")
+			body, err := emailToSMS(email, "body")
+			So(err, ShouldBeNil)
+			So(body, ShouldEqual, "/var is at 98%")
+		})
+	})
+
+	Convey("Checking senders and recipients", t, func() {
+		config := &emailConfig{domain: "sms.local", allowedSenders: []string{"ops@example.com", "@monitoring.example.com"}}
+
+		Convey("should allow listed addresses and domains", func() {
+			So(config.allowed("OPS@example.com"), ShouldBeTrue)
+			So(config.allowed("nagios@monitoring.example.com"), ShouldBeTrue)
+			So(config.allowed("someone@example.com"), ShouldBeFalse)
+		})
+
+		Convey("should only accept the sms domain", func() {
+			number, ok := config.numberFromRecipient("15555555555@SMS.local")
+			So(ok, ShouldBeTrue)
+			So(number, ShouldEqual, "15555555555")
+
+			_, ok = config.numberFromRecipient("15555555555@example.com")
+			So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("Checking clients", t, func() {
+		config := &emailConfig{allowedNetworks: []string{"10.0.0.0/8", " 192.168.1.5", "::1"}}
+
+		Convey("should allow listed networks and addresses", func() {
+			So(config.allowedClient(&net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 40000}), ShouldBeTrue)
+			So(config.allowedClient(&net.TCPAddr{IP: net.ParseIP("192.168.1.5"), Port: 40000}), ShouldBeTrue)
+			So(config.allowedClient(&net.TCPAddr{IP: net.ParseIP("::1"), Port: 40000}), ShouldBeTrue)
+			So(config.allowedClient(&net.TCPAddr{IP: net.ParseIP("192.168.1.6"), Port: 40000}), ShouldBeFalse)
+		})
+	})
+
+	Convey("Receiving email", t, func() {
+		config := &emailConfig{domain: "sms.local", allowedNetworks: []string{"127.0.0.1"}, allowedSenders: []string{"ops@example.com"}}
+		client, server := net.Pipe()
+		defer client.Close()
+		tp := textproto.NewConn(client)
+
+		Convey("should refuse clients outside the allowed networks", func() {
+			go serveSMTP(nil, nil, config, remoteConn{server, &net.TCPAddr{IP: net.ParseIP("203.0.113.1"), Port: 25}})
+			_, _, err := tp.ReadResponse(220)
+			So(err, ShouldNotBeNil)
+			So(err.(*textproto.Error).Code, ShouldEqual, 554)
+		})
+
+		Convey("should refuse messages over the size limit", func() {
+			go serveSMTP(nil, nil, config, remoteConn{server, &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 25}})
+			command := func(line string, expect int) error {
+				if line != "" {
+					tp.PrintfLine("%v", line)
+				}
+				_, _, err := tp.ReadResponse(expect)
+				return err
+			}
+			So(command("", 220), ShouldBeNil)
+			So(command("MAIL FROM:<ops@example.com>", 250), ShouldBeNil)
+			So(command("RCPT TO:<15555555555@sms.local>", 250), ShouldBeNil)
+			So(command("DATA", 354), ShouldBeNil)
+
+			go func() {
+				w := tp.DotWriter()
+				w.Write([]byte("Subject: big\r\n\r\n"))
+				w.Write(bytes.Repeat([]byte("x"), emailMaxBytes))
+				w.Close()
+			}()
+			_, _, err := tp.ReadResponse(250)
+			So(err, ShouldNotBeNil)
+			So(err.(*textproto.Error).Code, ShouldEqual, 552)
+		})
+	})
+}
+
+// remoteConn gives a piped connection a remote address
+type remoteConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c remoteConn) RemoteAddr() net.Addr {
+	return c.addr
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EventInbound = "inbound"
+	EventStatus  = "status"
+	EventModem   = "modem"
+)
+
+type Event struct {
+	ID     int64       `json:"id"`
+	Type   string      `json:"type"`
+	Number string      `json:"number,omitempty"`
+	Time   time.Time   `json:"time"`
+	Data   interface{} `json:"data"`
+}
+
+// eventBroker fans events out to subscribers, keeping recent events so
+// reconnecting clients can resume without missing any
+type eventBroker struct {
+	mutex       sync.Mutex
+	nextID      int64
+	history     []Event
+	size        int
+	subscribers map[chan Event]bool
+}
+
+func newEventBroker(size int) *eventBroker {
+	return &eventBroker{
+		nextID:      1,
+		size:        size,
+		subscribers: map[chan Event]bool{},
+	}
+}
+
+var events = newEventBroker(1000)
+
+func (b *eventBroker) publish(eventType string, number string, data interface{}) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	e := Event{ID: b.nextID, Type: eventType, Number: number, Time: time.Now().UTC(), Data: data}
+	b.nextID++
+
+	b.history = append(b.history, e)
+	if len(b.history) > b.size {
+		b.history = b.history[len(b.history)-b.size:]
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			// drop subscribers which can't keep up, they can resume from
+			// their last event
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe returns the events after lastID still in history and a channel
+// of new events
+func (b *eventBroker) subscribe(lastID int64) ([]Event, chan Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	backlog := []Event{}
+	for _, e := range b.history {
+		if e.ID > lastID {
+			backlog = append(backlog, e)
+		}
+	}
+
+	ch := make(chan Event, 64)
+	b.subscribers[ch] = true
+	return backlog, ch
+}
+
+func (b *eventBroker) unsubscribe(ch chan Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.subscribers[ch] {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// follow passes the events after afterID which match filter to handle, in
+// order, resubscribing from the last event passed whenever it falls behind.
+// It returns the first error from handle, or nil once done is closed.
+func (b *eventBroker) follow(afterID int64, filter *eventFilter, done <-chan struct{}, handle func(Event) error) error {
+	lastID := afterID
+	pass := func(e Event) error {
+		if filter == nil || filter.matches(e) {
+			if err := handle(e); err != nil {
+				return err
+			}
+		}
+		lastID = e.ID
+		return nil
+	}
+
+	for {
+		backlog, ch := b.subscribe(lastID)
+		for _, e := range backlog {
+			if err := pass(e); err != nil {
+				b.unsubscribe(ch)
+				return err
+			}
+		}
+
+	receive:
+		for {
+			select {
+			case e, more := <-ch:
+				if !more {
+					// dropped for falling behind, pick up where we left off
+					break receive
+				}
+				if err := pass(e); err != nil {
+					b.unsubscribe(ch)
+					return err
+				}
+			case <-done:
+				b.unsubscribe(ch)
+				return nil
+			}
+		}
+	}
+}
+
+// publishMessage announces a stored inbound message or an outbound message's
+// new status.  Callers publish once the change is committed.
+func publishMessage(m *Message) {
+	if m.Incoming {
+		events.publish(EventInbound, m.Number, *m)
+	} else {
+		events.publish(EventStatus, m.Number, *m)
+	}
+}
+
+type eventFilter struct {
+	types  map[string]bool
+	number string
+}
+
+// eventTypes filters events by type
+func eventTypes(types ...string) *eventFilter {
+	filter := eventFilter{types: map[string]bool{}}
+	for _, t := range types {
+		filter.types[t] = true
+	}
+	return &filter
+}
+
+func (f *eventFilter) matches(e Event) bool {
+	if len(f.types) > 0 && !f.types[e.Type] {
+		return false
+	}
+	return f.number == "" || f.number == e.Number
+}
+
+func createEventsHandler(format *numberFormat) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok || r.Method != "GET" {
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+
+		// eg ?types=inbound,status&number=15555555555
+		filter := eventFilter{types: map[string]bool{}}
+		if types := r.URL.Query().Get("types"); types != "" {
+			for _, t := range strings.Split(types, ",") {
+				filter.types[strings.TrimSpace(t)] = true
+			}
+		}
+		if number := r.URL.Query().Get("number"); number != "" {
+			filter.number = format.normalizeSender(number)
+		}
+
+		// browsers resume with the Last-Event-ID header
+		lastEventID := r.Header.Get("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = r.URL.Query().Get("last_event_id")
+		}
+		lastID, _ := strconv.ParseInt(lastEventID, 10, 64)
+
+		backlog, ch := events.subscribe(lastID)
+		defer events.unsubscribe(ch)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		write := func(e Event) {
+			if !filter.matches(e) {
+				return
+			}
+			str, _ := json.Marshal(e)
+			fmt.Fprintf(w, "id: %v\nevent: %v\ndata: %s\n\n", e.ID, e.Type, str)
+		}
+
+		for _, e := range backlog {
+			write(e)
+		}
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(15 * time.Second)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case e, more := <-ch:
+				if !more {
+					return
+				}
+				write(e)
+				flusher.Flush()
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep alive\n\n")
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+}
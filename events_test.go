@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEventBroker(t *testing.T) {
+	Convey("Subscribing to events", t, func() {
+		broker := newEventBroker(2)
+		broker.publish(EventModem, "", "one")
+		broker.publish(EventModem, "", "two")
+		broker.publish(EventModem, "", "three")
+
+		Convey("should resume after the last event seen", func() {
+			backlog, ch := broker.subscribe(2)
+			defer broker.unsubscribe(ch)
+			So(len(backlog), ShouldEqual, 1)
+			So(backlog[0].Data, ShouldEqual, "three")
+		})
+
+		Convey("should only keep recent events", func() {
+			backlog, ch := broker.subscribe(0)
+			defer broker.unsubscribe(ch)
+			So(len(backlog), ShouldEqual, 2)
+			So(backlog[0].ID, ShouldEqual, 2)
+		})
+
+		Convey("should deliver new events", func() {
+			_, ch := broker.subscribe(3)
+			defer broker.unsubscribe(ch)
+			broker.publish(EventInbound, "+15555555555", "four")
+			e := <-ch
+			So(e.ID, ShouldEqual, 4)
+			So(e.Number, ShouldEqual, "+15555555555")
+		})
+	})
+}
+
+func TestFollowEvents(t *testing.T) {
+	Convey("Following events", t, func() {
+		broker := newEventBroker(200)
+		broker.publish(EventModem, "", "one")
+		broker.publish(EventInbound, "+15555555555", "two")
+
+		Convey("should pass matching events in order, even after falling behind", func() {
+			errFinished := errors.New("finished")
+			release := make(chan bool)
+			received := []int64{}
+			result := make(chan error)
+			go func() {
+				result <- broker.follow(0, eventTypes(EventInbound), nil, func(e Event) error {
+					if len(received) == 0 {
+						<-release
+					}
+					received = append(received, e.ID)
+					if e.ID == 102 {
+						return errFinished
+					}
+					return nil
+				})
+			}()
+
+			for i := 0; i < 100; i++ {
+				broker.publish(EventInbound, "+15555555555", i)
+			}
+			close(release)
+
+			So(<-result, ShouldEqual, errFinished)
+			So(len(received), ShouldEqual, 101)
+			So(received[0], ShouldEqual, 2)
+			So(received[100], ShouldEqual, 102)
+		})
+
+		Convey("should stop once done is closed", func() {
+			done := make(chan struct{})
+			close(done)
+			So(broker.follow(2, nil, done, func(e Event) error { return nil }), ShouldBeNil)
+		})
+	})
+}
+
+// publishedSince returns the gateway's events published after lastID
+func publishedSince(lastID int64) []Event {
+	backlog, ch := events.subscribe(lastID)
+	events.unsubscribe(ch)
+	return backlog
+}
+
+func lastEventID() int64 {
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+	return events.nextID - 1
+}
+
+func TestMessageEvents(t *testing.T) {
+	Convey("Announcing message changes", t, func() {
+		db, err := newTestDB()
+		So(err, ShouldBeNil)
+		defer db.Close()
+
+		c, err := createCampaign(db, newNumberFormat("1", "1", "011"), &campaignRequest{
+			Body:       "open late tonight",
+			Recipients: []campaignRecipient{{Number: "5555550100"}, {Number: "5555550101"}},
+		})
+		So(err, ShouldBeNil)
+		lastID := lastEventID()
+
+		Convey("should announce each message a campaign pauses", func() {
+			So(setCampaignStatus(db, c, CampaignPaused), ShouldBeNil)
+
+			published := publishedSince(lastID)
+			So(len(published), ShouldEqual, 2)
+			for _, e := range published {
+				m := e.Data.(Message)
+				So(e.Type, ShouldEqual, EventStatus)
+				So(m.ID, ShouldNotBeEmpty)
+				So(m.CampaignID, ShouldEqual, c.ID)
+				So(m.Status, ShouldEqual, StatusPaused)
+			}
+		})
+
+		Convey("should not announce changes nobody published", func() {
+			So(db.Model(&Message{}).Where("campaign_id = ?", c.ID).Update("handled", true).Error, ShouldBeNil)
+			So(len(publishedSince(lastID)), ShouldEqual, 0)
+		})
+
+		Convey("should not announce a rolled back change", func() {
+			failInserts(db, "messages")
+			_, err := createCampaign(db, newNumberFormat("1", "1", "011"), &campaignRequest{
+				Body:       "open late tonight",
+				Recipients: []campaignRecipient{{Number: "5555550100"}},
+			})
+			So(err, ShouldNotBeNil)
+			So(len(publishedSince(lastID)), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,886 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: gateway.proto
+
+package gatewaypb // import "github.com/verticallabs/gsm-gateway/gatewaypb"
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+import timestamp "github.com/golang/protobuf/ptypes/timestamp"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type Message struct {
+	Id                   string               `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Number               string               `protobuf:"bytes,2,opt,name=number" json:"number,omitempty"`
+	Body                 string               `protobuf:"bytes,3,opt,name=body" json:"body,omitempty"`
+	Incoming             bool                 `protobuf:"varint,4,opt,name=incoming" json:"incoming,omitempty"`
+	Status               string               `protobuf:"bytes,5,opt,name=status" json:"status,omitempty"`
+	SendAt               *timestamp.Timestamp `protobuf:"bytes,6,opt,name=send_at,json=sendAt" json:"send_at,omitempty"`
+	Time                 *timestamp.Timestamp `protobuf:"bytes,7,opt,name=time" json:"time,omitempty"`
+	DelayReason          string               `protobuf:"bytes,8,opt,name=delay_reason,json=delayReason" json:"delay_reason,omitempty"`
+	Modem                string               `protobuf:"bytes,9,opt,name=modem" json:"modem,omitempty"`
+	ConversationId       string               `protobuf:"bytes,10,opt,name=conversation_id,json=conversationId" json:"conversation_id,omitempty"`
+	ScheduleId           string               `protobuf:"bytes,11,opt,name=schedule_id,json=scheduleId" json:"schedule_id,omitempty"`
+	CampaignId           string               `protobuf:"bytes,12,opt,name=campaign_id,json=campaignId" json:"campaign_id,omitempty"`
+	TemplateId           string               `protobuf:"bytes,13,opt,name=template_id,json=templateId" json:"template_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *Message) Reset()         { *m = Message{} }
+func (m *Message) String() string { return proto.CompactTextString(m) }
+func (*Message) ProtoMessage()    {}
+func (*Message) Descriptor() ([]byte, []int) {
+	return fileDescriptor_gateway_41efc3ae8c64638c, []int{0}
+}
+func (m *Message) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Message.Unmarshal(m, b)
+}
+func (m *Message) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Message.Marshal(b, m, deterministic)
+}
+func (dst *Message) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Message.Merge(dst, src)
+}
+func (m *Message) XXX_Size() int {
+	return xxx_messageInfo_Message.Size(m)
+}
+func (m *Message) XXX_DiscardUnknown() {
+	xxx_messageInfo_Message.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Message proto.InternalMessageInfo
+
+func (m *Message) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Message) GetNumber() string {
+	if m != nil {
+		return m.Number
+	}
+	return ""
+}
+
+func (m *Message) GetBody() string {
+	if m != nil {
+		return m.Body
+	}
+	return ""
+}
+
+func (m *Message) GetIncoming() bool {
+	if m != nil {
+		return m.Incoming
+	}
+	return false
+}
+
+func (m *Message) GetStatus() string {
+	if m != nil {
+		return m.Status
+	}
+	return ""
+}
+
+func (m *Message) GetSendAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.SendAt
+	}
+	return nil
+}
+
+func (m *Message) GetTime() *timestamp.Timestamp {
+	if m != nil {
+		return m.Time
+	}
+	return nil
+}
+
+func (m *Message) GetDelayReason() string {
+	if m != nil {
+		return m.DelayReason
+	}
+	return ""
+}
+
+func (m *Message) GetModem() string {
+	if m != nil {
+		return m.Modem
+	}
+	return ""
+}
+
+func (m *Message) GetConversationId() string {
+	if m != nil {
+		return m.ConversationId
+	}
+	return ""
+}
+
+func (m *Message) GetScheduleId() string {
+	if m != nil {
+		return m.ScheduleId
+	}
+	return ""
+}
+
+func (m *Message) GetCampaignId() string {
+	if m != nil {
+		return m.CampaignId
+	}
+	return ""
+}
+
+func (m *Message) GetTemplateId() string {
+	if m != nil {
+		return m.TemplateId
+	}
+	return ""
+}
+
+type SendMessageRequest struct {
+	Number               string               `protobuf:"bytes,1,opt,name=number" json:"number,omitempty"`
+	Body                 string               `protobuf:"bytes,2,opt,name=body" json:"body,omitempty"`
+	TemplateId           string               `protobuf:"bytes,3,opt,name=template_id,json=templateId" json:"template_id,omitempty"`
+	Variables            map[string]string    `protobuf:"bytes,4,rep,name=variables" json:"variables,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	SendAt               *timestamp.Timestamp `protobuf:"bytes,5,opt,name=send_at,json=sendAt" json:"send_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *SendMessageRequest) Reset()         { *m = SendMessageRequest{} }
+func (m *SendMessageRequest) String() string { return proto.CompactTextString(m) }
+func (*SendMessageRequest) ProtoMessage()    {}
+func (*SendMessageRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_gateway_41efc3ae8c64638c, []int{1}
+}
+func (m *SendMessageRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SendMessageRequest.Unmarshal(m, b)
+}
+func (m *SendMessageRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SendMessageRequest.Marshal(b, m, deterministic)
+}
+func (dst *SendMessageRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SendMessageRequest.Merge(dst, src)
+}
+func (m *SendMessageRequest) XXX_Size() int {
+	return xxx_messageInfo_SendMessageRequest.Size(m)
+}
+func (m *SendMessageRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SendMessageRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SendMessageRequest proto.InternalMessageInfo
+
+func (m *SendMessageRequest) GetNumber() string {
+	if m != nil {
+		return m.Number
+	}
+	return ""
+}
+
+func (m *SendMessageRequest) GetBody() string {
+	if m != nil {
+		return m.Body
+	}
+	return ""
+}
+
+func (m *SendMessageRequest) GetTemplateId() string {
+	if m != nil {
+		return m.TemplateId
+	}
+	return ""
+}
+
+func (m *SendMessageRequest) GetVariables() map[string]string {
+	if m != nil {
+		return m.Variables
+	}
+	return nil
+}
+
+func (m *SendMessageRequest) GetSendAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.SendAt
+	}
+	return nil
+}
+
+type GetMessageRequest struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetMessageRequest) Reset()         { *m = GetMessageRequest{} }
+func (m *GetMessageRequest) String() string { return proto.CompactTextString(m) }
+func (*GetMessageRequest) ProtoMessage()    {}
+func (*GetMessageRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_gateway_41efc3ae8c64638c, []int{2}
+}
+func (m *GetMessageRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetMessageRequest.Unmarshal(m, b)
+}
+func (m *GetMessageRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetMessageRequest.Marshal(b, m, deterministic)
+}
+func (dst *GetMessageRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetMessageRequest.Merge(dst, src)
+}
+func (m *GetMessageRequest) XXX_Size() int {
+	return xxx_messageInfo_GetMessageRequest.Size(m)
+}
+func (m *GetMessageRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetMessageRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetMessageRequest proto.InternalMessageInfo
+
+func (m *GetMessageRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type ListMessagesRequest struct {
+	Status               string   `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	ConversationId       string   `protobuf:"bytes,2,opt,name=conversation_id,json=conversationId" json:"conversation_id,omitempty"`
+	CampaignId           string   `protobuf:"bytes,3,opt,name=campaign_id,json=campaignId" json:"campaign_id,omitempty"`
+	Limit                int32    `protobuf:"varint,4,opt,name=limit" json:"limit,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListMessagesRequest) Reset()         { *m = ListMessagesRequest{} }
+func (m *ListMessagesRequest) String() string { return proto.CompactTextString(m) }
+func (*ListMessagesRequest) ProtoMessage()    {}
+func (*ListMessagesRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_gateway_41efc3ae8c64638c, []int{3}
+}
+func (m *ListMessagesRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListMessagesRequest.Unmarshal(m, b)
+}
+func (m *ListMessagesRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListMessagesRequest.Marshal(b, m, deterministic)
+}
+func (dst *ListMessagesRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListMessagesRequest.Merge(dst, src)
+}
+func (m *ListMessagesRequest) XXX_Size() int {
+	return xxx_messageInfo_ListMessagesRequest.Size(m)
+}
+func (m *ListMessagesRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListMessagesRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListMessagesRequest proto.InternalMessageInfo
+
+func (m *ListMessagesRequest) GetStatus() string {
+	if m != nil {
+		return m.Status
+	}
+	return ""
+}
+
+func (m *ListMessagesRequest) GetConversationId() string {
+	if m != nil {
+		return m.ConversationId
+	}
+	return ""
+}
+
+func (m *ListMessagesRequest) GetCampaignId() string {
+	if m != nil {
+		return m.CampaignId
+	}
+	return ""
+}
+
+func (m *ListMessagesRequest) GetLimit() int32 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+type ListMessagesResponse struct {
+	Messages             []*Message `protobuf:"bytes,1,rep,name=messages" json:"messages,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
+	XXX_unrecognized     []byte     `json:"-"`
+	XXX_sizecache        int32      `json:"-"`
+}
+
+func (m *ListMessagesResponse) Reset()         { *m = ListMessagesResponse{} }
+func (m *ListMessagesResponse) String() string { return proto.CompactTextString(m) }
+func (*ListMessagesResponse) ProtoMessage()    {}
+func (*ListMessagesResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_gateway_41efc3ae8c64638c, []int{4}
+}
+func (m *ListMessagesResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListMessagesResponse.Unmarshal(m, b)
+}
+func (m *ListMessagesResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListMessagesResponse.Marshal(b, m, deterministic)
+}
+func (dst *ListMessagesResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListMessagesResponse.Merge(dst, src)
+}
+func (m *ListMessagesResponse) XXX_Size() int {
+	return xxx_messageInfo_ListMessagesResponse.Size(m)
+}
+func (m *ListMessagesResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListMessagesResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListMessagesResponse proto.InternalMessageInfo
+
+func (m *ListMessagesResponse) GetMessages() []*Message {
+	if m != nil {
+		return m.Messages
+	}
+	return nil
+}
+
+type SubscribeInboundRequest struct {
+	Number               string   `protobuf:"bytes,1,opt,name=number" json:"number,omitempty"`
+	LastEventId          int64    `protobuf:"varint,2,opt,name=last_event_id,json=lastEventId" json:"last_event_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SubscribeInboundRequest) Reset()         { *m = SubscribeInboundRequest{} }
+func (m *SubscribeInboundRequest) String() string { return proto.CompactTextString(m) }
+func (*SubscribeInboundRequest) ProtoMessage()    {}
+func (*SubscribeInboundRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_gateway_41efc3ae8c64638c, []int{5}
+}
+func (m *SubscribeInboundRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubscribeInboundRequest.Unmarshal(m, b)
+}
+func (m *SubscribeInboundRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubscribeInboundRequest.Marshal(b, m, deterministic)
+}
+func (dst *SubscribeInboundRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubscribeInboundRequest.Merge(dst, src)
+}
+func (m *SubscribeInboundRequest) XXX_Size() int {
+	return xxx_messageInfo_SubscribeInboundRequest.Size(m)
+}
+func (m *SubscribeInboundRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubscribeInboundRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubscribeInboundRequest proto.InternalMessageInfo
+
+func (m *SubscribeInboundRequest) GetNumber() string {
+	if m != nil {
+		return m.Number
+	}
+	return ""
+}
+
+func (m *SubscribeInboundRequest) GetLastEventId() int64 {
+	if m != nil {
+		return m.LastEventId
+	}
+	return 0
+}
+
+type InboundEvent struct {
+	EventId              int64    `protobuf:"varint,1,opt,name=event_id,json=eventId" json:"event_id,omitempty"`
+	Message              *Message `protobuf:"bytes,2,opt,name=message" json:"message,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *InboundEvent) Reset()         { *m = InboundEvent{} }
+func (m *InboundEvent) String() string { return proto.CompactTextString(m) }
+func (*InboundEvent) ProtoMessage()    {}
+func (*InboundEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_gateway_41efc3ae8c64638c, []int{6}
+}
+func (m *InboundEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InboundEvent.Unmarshal(m, b)
+}
+func (m *InboundEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InboundEvent.Marshal(b, m, deterministic)
+}
+func (dst *InboundEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InboundEvent.Merge(dst, src)
+}
+func (m *InboundEvent) XXX_Size() int {
+	return xxx_messageInfo_InboundEvent.Size(m)
+}
+func (m *InboundEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_InboundEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InboundEvent proto.InternalMessageInfo
+
+func (m *InboundEvent) GetEventId() int64 {
+	if m != nil {
+		return m.EventId
+	}
+	return 0
+}
+
+func (m *InboundEvent) GetMessage() *Message {
+	if m != nil {
+		return m.Message
+	}
+	return nil
+}
+
+type GetModemStatusRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetModemStatusRequest) Reset()         { *m = GetModemStatusRequest{} }
+func (m *GetModemStatusRequest) String() string { return proto.CompactTextString(m) }
+func (*GetModemStatusRequest) ProtoMessage()    {}
+func (*GetModemStatusRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_gateway_41efc3ae8c64638c, []int{7}
+}
+func (m *GetModemStatusRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetModemStatusRequest.Unmarshal(m, b)
+}
+func (m *GetModemStatusRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetModemStatusRequest.Marshal(b, m, deterministic)
+}
+func (dst *GetModemStatusRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetModemStatusRequest.Merge(dst, src)
+}
+func (m *GetModemStatusRequest) XXX_Size() int {
+	return xxx_messageInfo_GetModemStatusRequest.Size(m)
+}
+func (m *GetModemStatusRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetModemStatusRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetModemStatusRequest proto.InternalMessageInfo
+
+type ModemStatus struct {
+	Modem                string               `protobuf:"bytes,1,opt,name=modem" json:"modem,omitempty"`
+	Service              string               `protobuf:"bytes,2,opt,name=service" json:"service,omitempty"`
+	Network              string               `protobuf:"bytes,3,opt,name=network" json:"network,omitempty"`
+	UpdatedAt            *timestamp.Timestamp `protobuf:"bytes,4,opt,name=updated_at,json=updatedAt" json:"updated_at,omitempty"`
+	SignalDbm            int32                `protobuf:"varint,5,opt,name=signal_dbm,json=signalDbm" json:"signal_dbm,omitempty"`
+	StorageUsed          int32                `protobuf:"varint,6,opt,name=storage_used,json=storageUsed" json:"storage_used,omitempty"`
+	StorageTotal         int32                `protobuf:"varint,7,opt,name=storage_total,json=storageTotal" json:"storage_total,omitempty"`
+	HealthCheckedAt      *timestamp.Timestamp `protobuf:"bytes,8,opt,name=health_checked_at,json=healthCheckedAt" json:"health_checked_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *ModemStatus) Reset()         { *m = ModemStatus{} }
+func (m *ModemStatus) String() string { return proto.CompactTextString(m) }
+func (*ModemStatus) ProtoMessage()    {}
+func (*ModemStatus) Descriptor() ([]byte, []int) {
+	return fileDescriptor_gateway_41efc3ae8c64638c, []int{8}
+}
+func (m *ModemStatus) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ModemStatus.Unmarshal(m, b)
+}
+func (m *ModemStatus) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ModemStatus.Marshal(b, m, deterministic)
+}
+func (dst *ModemStatus) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ModemStatus.Merge(dst, src)
+}
+func (m *ModemStatus) XXX_Size() int {
+	return xxx_messageInfo_ModemStatus.Size(m)
+}
+func (m *ModemStatus) XXX_DiscardUnknown() {
+	xxx_messageInfo_ModemStatus.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ModemStatus proto.InternalMessageInfo
+
+func (m *ModemStatus) GetModem() string {
+	if m != nil {
+		return m.Modem
+	}
+	return ""
+}
+
+func (m *ModemStatus) GetService() string {
+	if m != nil {
+		return m.Service
+	}
+	return ""
+}
+
+func (m *ModemStatus) GetNetwork() string {
+	if m != nil {
+		return m.Network
+	}
+	return ""
+}
+
+func (m *ModemStatus) GetUpdatedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.UpdatedAt
+	}
+	return nil
+}
+
+func (m *ModemStatus) GetSignalDbm() int32 {
+	if m != nil {
+		return m.SignalDbm
+	}
+	return 0
+}
+
+func (m *ModemStatus) GetStorageUsed() int32 {
+	if m != nil {
+		return m.StorageUsed
+	}
+	return 0
+}
+
+func (m *ModemStatus) GetStorageTotal() int32 {
+	if m != nil {
+		return m.StorageTotal
+	}
+	return 0
+}
+
+func (m *ModemStatus) GetHealthCheckedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.HealthCheckedAt
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Message)(nil), "gateway.Message")
+	proto.RegisterType((*SendMessageRequest)(nil), "gateway.SendMessageRequest")
+	proto.RegisterMapType((map[string]string)(nil), "gateway.SendMessageRequest.VariablesEntry")
+	proto.RegisterType((*GetMessageRequest)(nil), "gateway.GetMessageRequest")
+	proto.RegisterType((*ListMessagesRequest)(nil), "gateway.ListMessagesRequest")
+	proto.RegisterType((*ListMessagesResponse)(nil), "gateway.ListMessagesResponse")
+	proto.RegisterType((*SubscribeInboundRequest)(nil), "gateway.SubscribeInboundRequest")
+	proto.RegisterType((*InboundEvent)(nil), "gateway.InboundEvent")
+	proto.RegisterType((*GetModemStatusRequest)(nil), "gateway.GetModemStatusRequest")
+	proto.RegisterType((*ModemStatus)(nil), "gateway.ModemStatus")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for Gateway service
+
+type GatewayClient interface {
+	SendMessage(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (*Message, error)
+	GetMessage(ctx context.Context, in *GetMessageRequest, opts ...grpc.CallOption) (*Message, error)
+	ListMessages(ctx context.Context, in *ListMessagesRequest, opts ...grpc.CallOption) (*ListMessagesResponse, error)
+	SubscribeInbound(ctx context.Context, in *SubscribeInboundRequest, opts ...grpc.CallOption) (Gateway_SubscribeInboundClient, error)
+	GetModemStatus(ctx context.Context, in *GetModemStatusRequest, opts ...grpc.CallOption) (*ModemStatus, error)
+}
+
+type gatewayClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewGatewayClient(cc *grpc.ClientConn) GatewayClient {
+	return &gatewayClient{cc}
+}
+
+func (c *gatewayClient) SendMessage(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (*Message, error) {
+	out := new(Message)
+	err := grpc.Invoke(ctx, "/gateway.Gateway/SendMessage", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) GetMessage(ctx context.Context, in *GetMessageRequest, opts ...grpc.CallOption) (*Message, error) {
+	out := new(Message)
+	err := grpc.Invoke(ctx, "/gateway.Gateway/GetMessage", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) ListMessages(ctx context.Context, in *ListMessagesRequest, opts ...grpc.CallOption) (*ListMessagesResponse, error) {
+	out := new(ListMessagesResponse)
+	err := grpc.Invoke(ctx, "/gateway.Gateway/ListMessages", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) SubscribeInbound(ctx context.Context, in *SubscribeInboundRequest, opts ...grpc.CallOption) (Gateway_SubscribeInboundClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Gateway_serviceDesc.Streams[0], c.cc, "/gateway.Gateway/SubscribeInbound", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gatewaySubscribeInboundClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Gateway_SubscribeInboundClient interface {
+	Recv() (*InboundEvent, error)
+	grpc.ClientStream
+}
+
+type gatewaySubscribeInboundClient struct {
+	grpc.ClientStream
+}
+
+func (x *gatewaySubscribeInboundClient) Recv() (*InboundEvent, error) {
+	m := new(InboundEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *gatewayClient) GetModemStatus(ctx context.Context, in *GetModemStatusRequest, opts ...grpc.CallOption) (*ModemStatus, error) {
+	out := new(ModemStatus)
+	err := grpc.Invoke(ctx, "/gateway.Gateway/GetModemStatus", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Gateway service
+
+type GatewayServer interface {
+	SendMessage(context.Context, *SendMessageRequest) (*Message, error)
+	GetMessage(context.Context, *GetMessageRequest) (*Message, error)
+	ListMessages(context.Context, *ListMessagesRequest) (*ListMessagesResponse, error)
+	SubscribeInbound(*SubscribeInboundRequest, Gateway_SubscribeInboundServer) error
+	GetModemStatus(context.Context, *GetModemStatusRequest) (*ModemStatus, error)
+}
+
+func RegisterGatewayServer(s *grpc.Server, srv GatewayServer) {
+	s.RegisterService(&_Gateway_serviceDesc, srv)
+}
+
+func _Gateway_SendMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).SendMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gateway.Gateway/SendMessage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).SendMessage(ctx, req.(*SendMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_GetMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).GetMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gateway.Gateway/GetMessage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).GetMessage(ctx, req.(*GetMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_ListMessages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListMessagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).ListMessages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gateway.Gateway/ListMessages",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).ListMessages(ctx, req.(*ListMessagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_SubscribeInbound_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeInboundRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GatewayServer).SubscribeInbound(m, &gatewaySubscribeInboundServer{stream})
+}
+
+type Gateway_SubscribeInboundServer interface {
+	Send(*InboundEvent) error
+	grpc.ServerStream
+}
+
+type gatewaySubscribeInboundServer struct {
+	grpc.ServerStream
+}
+
+func (x *gatewaySubscribeInboundServer) Send(m *InboundEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Gateway_GetModemStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetModemStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).GetModemStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gateway.Gateway/GetModemStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).GetModemStatus(ctx, req.(*GetModemStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Gateway_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "gateway.Gateway",
+	HandlerType: (*GatewayServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SendMessage",
+			Handler:    _Gateway_SendMessage_Handler,
+		},
+		{
+			MethodName: "GetMessage",
+			Handler:    _Gateway_GetMessage_Handler,
+		},
+		{
+			MethodName: "ListMessages",
+			Handler:    _Gateway_ListMessages_Handler,
+		},
+		{
+			MethodName: "GetModemStatus",
+			Handler:    _Gateway_GetModemStatus_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubscribeInbound",
+			Handler:       _Gateway_SubscribeInbound_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "gateway.proto",
+}
+
+func init() { proto.RegisterFile("gateway.proto", fileDescriptor_gateway_41efc3ae8c64638c) }
+
+var fileDescriptor_gateway_41efc3ae8c64638c = []byte{
+	// 829 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x54, 0xcd, 0x92, 0xdb, 0x44,
+	0x10, 0x2e, 0xc9, 0xf6, 0xda, 0x6e, 0xed, 0x6e, 0x36, 0xc3, 0x86, 0x08, 0x41, 0x88, 0x51, 0x0e,
+	0x6c, 0xa5, 0xc0, 0xa6, 0x36, 0x07, 0x48, 0xc8, 0x65, 0x21, 0x3f, 0x6c, 0x41, 0x2e, 0xda, 0x2c,
+	0x07, 0x2e, 0xae, 0x91, 0xa6, 0x91, 0xa7, 0x56, 0x3f, 0x46, 0x33, 0x72, 0xca, 0x0f, 0xc1, 0x2b,
+	0x70, 0xe1, 0x49, 0x78, 0x1a, 0x5e, 0x83, 0xd2, 0xfc, 0xd8, 0xf2, 0x4f, 0xd8, 0x9c, 0xa4, 0xfe,
+	0xe6, 0xeb, 0x56, 0xf7, 0x7c, 0x5f, 0x0b, 0x8e, 0x52, 0x2a, 0xf1, 0x1d, 0x5d, 0x8e, 0xe7, 0x55,
+	0x29, 0x4b, 0xd2, 0x37, 0x61, 0xf0, 0x30, 0x2d, 0xcb, 0x34, 0xc3, 0x89, 0x82, 0xe3, 0xfa, 0xf7,
+	0x89, 0xe4, 0x39, 0x0a, 0x49, 0xf3, 0xb9, 0x66, 0x86, 0x7f, 0x77, 0xa0, 0xff, 0x06, 0x85, 0xa0,
+	0x29, 0x92, 0x63, 0x70, 0x39, 0xf3, 0x9d, 0x91, 0x73, 0x36, 0x8c, 0x5c, 0xce, 0xc8, 0xc7, 0x70,
+	0x50, 0xd4, 0x79, 0x8c, 0x95, 0xef, 0x2a, 0xcc, 0x44, 0x84, 0x40, 0x37, 0x2e, 0xd9, 0xd2, 0xef,
+	0x28, 0x54, 0xbd, 0x93, 0x00, 0x06, 0xbc, 0x48, 0xca, 0x9c, 0x17, 0xa9, 0xdf, 0x1d, 0x39, 0x67,
+	0x83, 0x68, 0x15, 0x37, 0x75, 0x84, 0xa4, 0xb2, 0x16, 0x7e, 0x4f, 0xd7, 0xd1, 0x11, 0x79, 0x02,
+	0x7d, 0x81, 0x05, 0x9b, 0x52, 0xe9, 0x1f, 0x8c, 0x9c, 0x33, 0xef, 0x3c, 0x18, 0xeb, 0x76, 0xc7,
+	0xb6, 0xdd, 0xf1, 0x5b, 0xdb, 0x6e, 0x74, 0xd0, 0x50, 0x2f, 0x24, 0x19, 0x43, 0xb7, 0x99, 0xc1,
+	0xef, 0xdf, 0x9a, 0xa1, 0x78, 0xe4, 0x0b, 0x38, 0x64, 0x98, 0xd1, 0xe5, 0xb4, 0x42, 0x2a, 0xca,
+	0xc2, 0x1f, 0xa8, 0x16, 0x3c, 0x85, 0x45, 0x0a, 0x22, 0xa7, 0xd0, 0xcb, 0x4b, 0x86, 0xb9, 0x3f,
+	0x54, 0x67, 0x3a, 0x20, 0x5f, 0xc2, 0x9d, 0xa4, 0x2c, 0x16, 0x58, 0x09, 0x2a, 0x79, 0x59, 0x4c,
+	0x39, 0xf3, 0x41, 0x9d, 0x1f, 0xb7, 0xe1, 0x4b, 0x46, 0x1e, 0x82, 0x27, 0x92, 0x19, 0xb2, 0x3a,
+	0xc3, 0x86, 0xe4, 0x29, 0x12, 0x58, 0x48, 0x13, 0x12, 0x9a, 0xcf, 0x29, 0x4f, 0x55, 0x95, 0x43,
+	0x4d, 0xb0, 0x90, 0x26, 0x48, 0xcc, 0xe7, 0x19, 0x95, 0xaa, 0xc2, 0x91, 0x26, 0x58, 0xe8, 0x92,
+	0x85, 0x7f, 0xb9, 0x40, 0xae, 0xb0, 0x60, 0x46, 0xa9, 0x08, 0xff, 0xa8, 0x51, 0xc8, 0x96, 0x40,
+	0xce, 0x5e, 0x81, 0xdc, 0x96, 0x40, 0x5b, 0xdf, 0xe8, 0x6c, 0x7f, 0x83, 0xfc, 0x04, 0xc3, 0x05,
+	0xad, 0x38, 0x8d, 0x33, 0x14, 0x7e, 0x77, 0xd4, 0x39, 0xf3, 0xce, 0x1f, 0x8f, 0xad, 0xad, 0x76,
+	0x3f, 0x3e, 0xfe, 0xd5, 0x92, 0x5f, 0x16, 0xb2, 0x5a, 0x46, 0xeb, 0xe4, 0xb6, 0xae, 0xbd, 0x0f,
+	0xd5, 0x35, 0x78, 0x0e, 0xc7, 0x9b, 0x15, 0xc9, 0x09, 0x74, 0x6e, 0x70, 0x69, 0x46, 0x6b, 0x5e,
+	0x1b, 0xa1, 0x16, 0x34, 0xab, 0xd1, 0x0c, 0xa6, 0x83, 0x67, 0xee, 0x77, 0x4e, 0xf8, 0x08, 0xee,
+	0xbe, 0x46, 0xb9, 0x75, 0x3d, 0x5b, 0x7e, 0x0e, 0xff, 0x74, 0xe0, 0xa3, 0x5f, 0xb8, 0xb0, 0x34,
+	0xd1, 0xba, 0x46, 0xe3, 0x4f, 0x67, 0xc3, 0x9f, 0x7b, 0x1c, 0xe0, 0xbe, 0xcf, 0x01, 0x6d, 0x81,
+	0x3b, 0x3b, 0x02, 0x9f, 0x42, 0x2f, 0xe3, 0x39, 0x97, 0x6a, 0x35, 0x7a, 0x91, 0x0e, 0xc2, 0x17,
+	0x70, 0xba, 0xd9, 0x8e, 0x98, 0x97, 0x85, 0x40, 0xf2, 0x15, 0x0c, 0x72, 0x83, 0xf9, 0x8e, 0x12,
+	0xe2, 0x64, 0x25, 0x84, 0x1d, 0x71, 0xc5, 0x08, 0xaf, 0xe1, 0xfe, 0x55, 0x1d, 0x8b, 0xa4, 0xe2,
+	0x31, 0x5e, 0x16, 0x71, 0x59, 0x17, 0xec, 0x36, 0x7f, 0x84, 0x70, 0x94, 0x51, 0x21, 0xa7, 0xb8,
+	0xc0, 0x42, 0xda, 0xb1, 0x3a, 0x91, 0xd7, 0x80, 0x2f, 0x1b, 0xec, 0x92, 0x85, 0xd7, 0x70, 0x68,
+	0xaa, 0x29, 0x84, 0x7c, 0x02, 0x83, 0x15, 0xdd, 0x51, 0xf4, 0x3e, 0x6a, 0x2a, 0x79, 0x0c, 0x7d,
+	0xd3, 0x8d, 0x2a, 0xb4, 0xaf, 0x5d, 0x4b, 0x08, 0xef, 0xc3, 0xbd, 0x46, 0xa8, 0x66, 0xc3, 0xae,
+	0xd4, 0x2d, 0x9b, 0x5e, 0xc3, 0x7f, 0x5c, 0xf0, 0x5a, 0xf0, 0x7a, 0x29, 0x9d, 0xf6, 0x52, 0xfa,
+	0x8d, 0xb5, 0xaa, 0x05, 0x4f, 0xac, 0x07, 0x6c, 0xd8, 0x9c, 0x14, 0x28, 0xdf, 0x95, 0xd5, 0x8d,
+	0xb9, 0x7f, 0x1b, 0x92, 0xa7, 0x00, 0xf5, 0x9c, 0x51, 0x89, 0xca, 0x91, 0xdd, 0x5b, 0x1d, 0x39,
+	0x34, 0xec, 0x0b, 0x49, 0x1e, 0x00, 0x08, 0x9e, 0x16, 0x34, 0x9b, 0xb2, 0x38, 0x57, 0x66, 0xee,
+	0x45, 0x43, 0x8d, 0xbc, 0x88, 0xf3, 0xe6, 0xdf, 0x22, 0x64, 0x59, 0xd1, 0x14, 0xa7, 0xb5, 0x40,
+	0xa6, 0xfe, 0x62, 0xbd, 0xc8, 0x33, 0xd8, 0xb5, 0x40, 0x46, 0x1e, 0xc1, 0x91, 0xa5, 0xc8, 0x52,
+	0xd2, 0x4c, 0xfd, 0xb7, 0x7a, 0x91, 0xcd, 0x7b, 0xdb, 0x60, 0xe4, 0x15, 0xdc, 0x9d, 0x21, 0xcd,
+	0xe4, 0x6c, 0x9a, 0xcc, 0x30, 0xb9, 0xd1, 0x8d, 0x0e, 0x6e, 0x6d, 0xf4, 0x8e, 0x4e, 0xfa, 0x51,
+	0xe7, 0x5c, 0xc8, 0xf3, 0x7f, 0x5d, 0xe8, 0xbf, 0xd6, 0x37, 0x4f, 0x9e, 0x83, 0xd7, 0x5a, 0x5a,
+	0xf2, 0xe9, 0xff, 0xac, 0x72, 0xb0, 0xa3, 0x17, 0x79, 0x06, 0xb0, 0xde, 0x27, 0x12, 0xac, 0xce,
+	0x77, 0x96, 0x6c, 0x4f, 0xee, 0xcf, 0x70, 0xd8, 0xb6, 0x35, 0xf9, 0x6c, 0xc5, 0xd8, 0xb3, 0x7c,
+	0xc1, 0x83, 0xf7, 0x9c, 0x9a, 0x5d, 0x78, 0x03, 0x27, 0xdb, 0xee, 0x26, 0xa3, 0xf5, 0x2c, 0xfb,
+	0x8d, 0x1f, 0xdc, 0x5b, 0x31, 0xda, 0x1e, 0xfe, 0xc6, 0x21, 0xaf, 0xe0, 0x78, 0xd3, 0x7e, 0xe4,
+	0xf3, 0x8d, 0xd9, 0x76, 0x7c, 0x19, 0x9c, 0xae, 0xe7, 0x5b, 0x1f, 0xfe, 0xf0, 0xf4, 0xb7, 0x6f,
+	0x53, 0x2e, 0x67, 0x75, 0x3c, 0x4e, 0xca, 0x7c, 0xb2, 0xc0, 0x4a, 0xf2, 0x84, 0x66, 0x19, 0x8d,
+	0xc5, 0x24, 0x15, 0xf9, 0xd7, 0x26, 0x65, 0x62, 0x9e, 0xf3, 0xf8, 0xfb, 0xd5, 0x5b, 0x7c, 0xa0,
+	0x94, 0x7c, 0xf2, 0xdf, 0x00, 0x1b, 0xaa, 0x03, 0x97, 0xb3, 0x07, 0x00, 0x00,
+}
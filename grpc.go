@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/barnybug/gogsmmodem"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/jinzhu/gorm"
+	"github.com/verticallabs/gsm-gateway/gatewaypb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServer implements gatewaypb.GatewayServer over the same message store
+// and send path as the http api
+type grpcServer struct {
+	db      *gorm.DB
+	modem   *gogsmmodem.Modem
+	limiter *rateLimiter
+	format  *numberFormat
+}
+
+func timestampProto(t time.Time) *timestamp.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	ts, _ := ptypes.TimestampProto(t)
+	return ts
+}
+
+func toProtoMessage(m *Message) *gatewaypb.Message {
+	pm := &gatewaypb.Message{
+		Id:             m.ID,
+		Number:         m.Number,
+		Body:           m.Body,
+		Incoming:       m.Incoming,
+		Status:         m.Status,
+		Time:           timestampProto(m.Time),
+		DelayReason:    m.DelayReason,
+		Modem:          m.Modem,
+		ConversationId: m.ConversationID,
+		ScheduleId:     m.ScheduleID,
+		CampaignId:     m.CampaignID,
+		TemplateId:     m.TemplateID,
+	}
+	if m.SendAt != nil {
+		pm.SendAt = timestampProto(*m.SendAt)
+	}
+	return pm
+}
+
+// grpcMessageError maps an error from submitMessage to a grpc status, as
+// writeMessageError does for http
+func grpcMessageError(err error) error {
+	if err == errSuppressed {
+		return status.Error(codes.PermissionDenied, err.Error())
+	} else if _, ok := err.(invalidMessageError); ok {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, "Failed to send")
+}
+
+func (s *grpcServer) SendMessage(ctx context.Context, req *gatewaypb.SendMessageRequest) (*gatewaypb.Message, error) {
+	m := Message{
+		Number:     req.Number,
+		Body:       req.Body,
+		TemplateID: req.TemplateId,
+		Variables:  req.Variables,
+	}
+	if req.SendAt != nil {
+		sendAt, err := ptypes.Timestamp(req.SendAt)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		m.SendAt = &sendAt
+	}
+
+	if _, err := submitMessage(s.db, s.modem, s.limiter, s.format, &m); err != nil {
+		return nil, grpcMessageError(err)
+	}
+	return toProtoMessage(&m), nil
+}
+
+func (s *grpcServer) GetMessage(ctx context.Context, req *gatewaypb.GetMessageRequest) (*gatewaypb.Message, error) {
+	var m Message
+	if s.db.Where("id = ?", req.Id).First(&m).RecordNotFound() {
+		return nil, status.Error(codes.NotFound, "Message not found")
+	}
+	return toProtoMessage(&m), nil
+}
+
+func (s *grpcServer) ListMessages(ctx context.Context, req *gatewaypb.ListMessagesRequest) (*gatewaypb.ListMessagesResponse, error) {
+	query := messagesQuery(s.db, "", req.ConversationId, req.CampaignId, req.Status)
+	if req.Limit > 0 {
+		query = query.Limit(req.Limit)
+	}
+
+	messages := []Message{}
+	if err := query.Find(&messages).Error; err != nil {
+		return nil, status.Error(codes.Internal, "Failed to list")
+	}
+
+	res := &gatewaypb.ListMessagesResponse{}
+	for i := range messages {
+		res.Messages = append(res.Messages, toProtoMessage(&messages[i]))
+	}
+	return res, nil
+}
+
+// SubscribeInbound streams inbound messages from the event broker, resuming
+// after last_event_id when it is still in history
+func (s *grpcServer) SubscribeInbound(req *gatewaypb.SubscribeInboundRequest, stream gatewaypb.Gateway_SubscribeInboundServer) error {
+	filter := eventTypes(EventInbound)
+	if req.Number != "" {
+		filter.number = s.format.normalizeSender(req.Number)
+	}
+
+	return events.follow(req.LastEventId, filter, stream.Context().Done(), func(e Event) error {
+		m, ok := e.Data.(Message)
+		if !ok {
+			return nil
+		}
+		return stream.Send(&gatewaypb.InboundEvent{EventId: e.ID, Message: toProtoMessage(&m)})
+	})
+}
+
+func (s *grpcServer) GetModemStatus(ctx context.Context, req *gatewaypb.GetModemStatusRequest) (*gatewaypb.ModemStatus, error) {
+	current := getModemStatus()
+	status := &gatewaypb.ModemStatus{
+		Modem:           current.Modem,
+		Service:         current.Service,
+		Network:         current.Network,
+		UpdatedAt:       timestampProto(current.UpdatedAt),
+		StorageUsed:     int32(current.StorageUsed),
+		StorageTotal:    int32(current.StorageTotal),
+		HealthCheckedAt: timestampProto(current.HealthCheckedAt),
+	}
+	if current.SignalDBM != nil {
+		status.SignalDbm = int32(*current.SignalDBM)
+	}
+	return status, nil
+}
+
+// grpcAuthorize checks the authorization metadata as requireAPIKey does for
+// http
+func grpcAuthorize(ctx context.Context, db *gorm.DB, adminToken string) error {
+	given := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md["authorization"]) > 0 {
+		given = strings.TrimPrefix(md["authorization"][0], "Bearer ")
+	}
+	if !validToken(db, adminToken, given) {
+		return status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+	return nil
+}
+
+func listenOnGRPC(db *gorm.DB, modem *gogsmmodem.Modem, limiter *rateLimiter, format *numberFormat, adminToken string, apiKeysRequired bool, port string) chan error {
+	errorChannel := make(chan error, 1)
+
+	options := []grpc.ServerOption{}
+	if apiKeysRequired {
+		options = append(options,
+			grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				if err := grpcAuthorize(ctx, db, adminToken); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := grpcAuthorize(stream.Context(), db, adminToken); err != nil {
+					return err
+				}
+				return handler(srv, stream)
+			}))
+	}
+
+	server := grpc.NewServer(options...)
+	gatewaypb.RegisterGatewayServer(server, &grpcServer{db: db, modem: modem, limiter: limiter, format: format})
+	// lets tools like grpcurl discover the service
+	reflection.Register(server)
+
+	go func() {
+		for {
+			listener, err := net.Listen("tcp", ":"+port)
+			if err == nil {
+				err = server.Serve(listener)
+			}
+			errorChannel <- err
+			time.Sleep(1 * time.Second)
+		}
+	}()
+
+	return errorChannel
+}
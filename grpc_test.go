@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/verticallabs/gsm-gateway/gatewaypb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPC(t *testing.T) {
+	Convey("Converting messages for grpc", t, func() {
+		sendAt := time.Date(2018, 5, 1, 9, 30, 0, 0, time.UTC)
+		m := Message{ID: "abc", Number: "+15555555555", Body: "hello", Status: StatusScheduled, SendAt: &sendAt}
+
+		Convey("should copy fields and timestamps", func() {
+			pm := toProtoMessage(&m)
+			So(pm.Id, ShouldEqual, "abc")
+			So(pm.Number, ShouldEqual, "+15555555555")
+			So(pm.Status, ShouldEqual, StatusScheduled)
+			So(pm.SendAt.Seconds, ShouldEqual, sendAt.Unix())
+		})
+
+		Convey("should leave unset times empty", func() {
+			So(toProtoMessage(&m).Time, ShouldBeNil)
+		})
+	})
+
+	Convey("Mapping send errors to grpc codes", t, func() {
+		So(status.Code(grpcMessageError(errSuppressed)), ShouldEqual, codes.PermissionDenied)
+		So(status.Code(grpcMessageError(invalidMessageError{errors.New("Message is too long")})), ShouldEqual, codes.InvalidArgument)
+		So(status.Code(grpcMessageError(errors.New("modem error"))), ShouldEqual, codes.Internal)
+	})
+
+	Convey("Getting the modem status", t, func() {
+		checked := time.Date(2018, 5, 1, 9, 30, 0, 0, time.UTC)
+		signal := -73
+		modemStatusMutex.Lock()
+		saved := currentModemStatus
+		currentModemStatus = modemStatus{Modem: "ready", SignalDBM: &signal, StorageUsed: 3, StorageTotal: 30, HealthCheckedAt: checked}
+		modemStatusMutex.Unlock()
+		defer func() {
+			modemStatusMutex.Lock()
+			currentModemStatus = saved
+			modemStatusMutex.Unlock()
+		}()
+
+		s, err := (&grpcServer{}).GetModemStatus(context.Background(), &gatewaypb.GetModemStatusRequest{})
+		So(err, ShouldBeNil)
+		So(s.Modem, ShouldEqual, "ready")
+		So(s.SignalDbm, ShouldEqual, -73)
+		So(s.StorageUsed, ShouldEqual, 3)
+		So(s.StorageTotal, ShouldEqual, 30)
+		So(s.HealthCheckedAt.Seconds, ShouldEqual, checked.Unix())
+	})
+}
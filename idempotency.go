@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// idempotencyClaimTimeout frees keys held by requests which never completed,
+// say when the gateway was restarted mid-send
+const idempotencyClaimTimeout = 5 * time.Minute
+
+// IdempotencyKey records the result of a send request so a retry with the
+// same Idempotency-Key header gets the original message back instead of
+// sending it again.  Keys are scoped to the caller's api key, and the hash of
+// the request body guards against reusing a key for a different message.
+// Status is zero while the first request is in progress.
+type IdempotencyKey struct {
+	Caller      string `gorm:"primary_key;size:64"`
+	Key         string `gorm:"primary_key;size:255"`
+	RequestHash string `gorm:"size:64"`
+	MessageID   string
+	Status      int
+	CreatedAt   time.Time
+}
+
+// idempotencyCaller identifies the api key or admin token making a request.
+// Requests without one share the hash of the empty token, which also keeps
+// the primary key from being blank.
+func idempotencyCaller(r *http.Request) string {
+	return hashAPIKey(requestToken(r))
+}
+
+func hashRequest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// claimIdempotencyKey stores the caller's key for a new request, or returns
+// the existing record when the key was used within the retention window
+func claimIdempotencyKey(db *gorm.DB, caller, key, requestHash string, retention time.Duration) (*IdempotencyKey, bool, error) {
+	// expired keys and abandoned claims can be used again.  created_at is set
+	// by gorm in local time
+	now := time.Now()
+	err := db.Where("created_at < ? OR (status = 0 AND created_at < ?)", now.Add(-retention), now.Add(-idempotencyClaimTimeout)).
+		Delete(&IdempotencyKey{}).Error
+	if err != nil {
+		return nil, false, err
+	}
+
+	// the primary key makes concurrent requests with the same key race to
+	// insert, only one wins
+	claim := IdempotencyKey{Caller: caller, Key: key, RequestHash: requestHash}
+	createErr := db.Create(&claim).Error
+	if createErr == nil {
+		return &claim, true, nil
+	}
+
+	var existing IdempotencyKey
+	if db.Where("caller = ? AND key = ?", caller, key).First(&existing).RecordNotFound() {
+		return nil, false, createErr
+	}
+	return &existing, false, nil
+}
+
+// completeIdempotencyKey records the response to the request holding the
+// claim.  Requests which failed before a message was stored release the key
+// so they can be corrected and retried.
+func completeIdempotencyKey(db *gorm.DB, claim *IdempotencyKey, m *Message, status int, err error) {
+	query := db.Where("caller = ? AND key = ?", claim.Caller, claim.Key)
+	if err != nil && (m.ID == "" || db.Where("id = ?", m.ID).First(&Message{}).Error != nil) {
+		query.Delete(&IdempotencyKey{})
+		return
+	}
+
+	query.Model(&IdempotencyKey{}).Updates(map[string]interface{}{"message_id": m.ID, "status": status})
+}
+
+// replayIdempotentResponse responds to a repeated request with the message
+// created by the original one
+func replayIdempotentResponse(w http.ResponseWriter, db *gorm.DB, existing *IdempotencyKey, requestHash string) {
+	if existing.RequestHash != requestHash {
+		http.Error(w, "422 Idempotency-Key was used for a different request.", http.StatusUnprocessableEntity)
+		return
+	}
+	if existing.Status == 0 {
+		http.Error(w, "409 Request with this Idempotency-Key is in progress.", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Idempotent-Replayed", "true")
+	var m Message
+	if existing.Status >= 500 || db.Where("id = ?", existing.MessageID).First(&m).RecordNotFound() {
+		http.Error(w, "500 Failed to send.", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, existing.Status, m)
+}
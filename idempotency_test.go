@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIdempotency(t *testing.T) {
+	Convey("Claiming an idempotency key", t, func() {
+		db, err := newTestDB()
+		So(err, ShouldBeNil)
+		defer db.Close()
+
+		claim, claimed, err := claimIdempotencyKey(db, "caller", "retry-1", "hash", time.Hour)
+		So(err, ShouldBeNil)
+		So(claimed, ShouldBeTrue)
+
+		Convey("should hand an in progress claim back to a retry", func() {
+			existing, claimed, err := claimIdempotencyKey(db, "caller", "retry-1", "hash", time.Hour)
+			So(err, ShouldBeNil)
+			So(claimed, ShouldBeFalse)
+			So(existing.Status, ShouldEqual, 0)
+		})
+
+		Convey("should keep keys of other callers apart", func() {
+			_, claimed, err := claimIdempotencyKey(db, "other", "retry-1", "hash", time.Hour)
+			So(err, ShouldBeNil)
+			So(claimed, ShouldBeTrue)
+		})
+
+		Convey("should record the response once complete", func() {
+			m := Message{ID: "sent", Number: "+15555550100", Status: StatusSent}
+			So(db.Create(&m).Error, ShouldBeNil)
+			completeIdempotencyKey(db, claim, &m, http.StatusOK, nil)
+
+			existing, claimed, err := claimIdempotencyKey(db, "caller", "retry-1", "hash", time.Hour)
+			So(err, ShouldBeNil)
+			So(claimed, ShouldBeFalse)
+			So(existing.MessageID, ShouldEqual, "sent")
+			So(existing.Status, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("should release the key when the request is invalid", func() {
+			completeIdempotencyKey(db, claim, &Message{}, http.StatusInternalServerError, invalidMessageError{errors.New("Invalid phone number")})
+
+			_, claimed, err := claimIdempotencyKey(db, "caller", "retry-1", "other hash", time.Hour)
+			So(err, ShouldBeNil)
+			So(claimed, ShouldBeTrue)
+		})
+
+		Convey("should release the key when the message couldn't be stored", func() {
+			completeIdempotencyKey(db, claim, &Message{ID: "unsaved"}, http.StatusInternalServerError, errors.New("database is locked"))
+
+			_, claimed, err := claimIdempotencyKey(db, "caller", "retry-1", "hash", time.Hour)
+			So(err, ShouldBeNil)
+			So(claimed, ShouldBeTrue)
+		})
+
+		Convey("should record a failure to send a stored message", func() {
+			m := Message{ID: "failed", Number: "+15555550100", Status: StatusFailed}
+			So(db.Create(&m).Error, ShouldBeNil)
+			completeIdempotencyKey(db, claim, &m, http.StatusInternalServerError, errors.New("modem error"))
+
+			existing, claimed, err := claimIdempotencyKey(db, "caller", "retry-1", "hash", time.Hour)
+			So(err, ShouldBeNil)
+			So(claimed, ShouldBeFalse)
+			So(existing.Status, ShouldEqual, http.StatusInternalServerError)
+		})
+
+		Convey("should free claims which never completed", func() {
+			So(db.Model(&IdempotencyKey{}).Where("key = ?", "retry-1").
+				UpdateColumn("created_at", time.Now().Add(-2*idempotencyClaimTimeout)).Error, ShouldBeNil)
+
+			_, claimed, err := claimIdempotencyKey(db, "caller", "retry-1", "hash", time.Hour)
+			So(err, ShouldBeNil)
+			So(claimed, ShouldBeTrue)
+		})
+
+		Convey("should free completed keys after the retention window", func() {
+			completeIdempotencyKey(db, claim, &Message{ID: "sent"}, http.StatusOK, nil)
+			So(db.Model(&IdempotencyKey{}).Where("key = ?", "retry-1").
+				UpdateColumn("created_at", time.Now().Add(-2*time.Hour)).Error, ShouldBeNil)
+
+			_, claimed, err := claimIdempotencyKey(db, "caller", "retry-1", "hash", time.Hour)
+			So(err, ShouldBeNil)
+			So(claimed, ShouldBeTrue)
+		})
+	})
+
+	Convey("Replaying a request", t, func() {
+		db, err := newTestDB()
+		So(err, ShouldBeNil)
+		defer db.Close()
+
+		Convey("should conflict while the original is in progress", func() {
+			w := httptest.NewRecorder()
+			replayIdempotentResponse(w, db, &IdempotencyKey{Key: "retry-1", RequestHash: "hash"}, "hash")
+			So(w.Code, ShouldEqual, http.StatusConflict)
+		})
+
+		Convey("should refuse a different request with the same key", func() {
+			w := httptest.NewRecorder()
+			replayIdempotentResponse(w, db, &IdempotencyKey{Key: "retry-1", RequestHash: "hash", MessageID: "sent", Status: http.StatusOK}, "other hash")
+			So(w.Code, ShouldEqual, http.StatusUnprocessableEntity)
+		})
+
+		Convey("should return the original message", func() {
+			So(db.Create(&Message{ID: "sent", Number: "+15555550100", Status: StatusSent}).Error, ShouldBeNil)
+
+			w := httptest.NewRecorder()
+			replayIdempotentResponse(w, db, &IdempotencyKey{Key: "retry-1", RequestHash: "hash", MessageID: "sent", Status: http.StatusOK}, "hash")
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Header().Get("Idempotent-Replayed"), ShouldEqual, "true")
+			So(w.Body.String(), ShouldContainSubstring, `"id":"sent"`)
+		})
+	})
+}
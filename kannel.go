@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Kannel compatible sendsms and get-url interfaces for integrations migrating
+// from Kannel
+
+const FormatKannel = "kannel"
+
+// kannel dlr-mask bits
+const (
+	kannelDelivered     = 1
+	kannelUndelivered   = 2
+	kannelQueued        = 4
+	kannelSMSCSubmit    = 8
+	kannelSMSCRejected  = 16
+	kannelMaxReplyBytes = 1024
+)
+
+// expandKannelURL fills in Kannel's get-url and dlr-url escapes.  As in
+// Kannel's delivery reports, %p is the phone for outbound messages too.
+func expandKannelURL(template string, m *Message, modemName string, dlr int) string {
+	words := strings.Fields(m.Body)
+	keyword := ""
+	if len(words) > 0 {
+		keyword = strings.ToLower(words[0])
+	}
+
+	var expanded strings.Builder
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' || i+1 == len(template) {
+			expanded.WriteByte(template[i])
+			continue
+		}
+
+		i++
+		switch template[i] {
+		case 'p':
+			expanded.WriteString(url.QueryEscape(m.Number))
+		case 'P':
+			expanded.WriteString(url.QueryEscape(modemName))
+		case 'a':
+			expanded.WriteString(url.QueryEscape(strings.Join(words, " ")))
+		case 'b':
+			expanded.WriteString(url.QueryEscape(m.Body))
+		case 'k':
+			expanded.WriteString(url.QueryEscape(keyword))
+		case 't':
+			expanded.WriteString(url.QueryEscape(m.Time.Format("2006-01-02 15:04:05")))
+		case 'T':
+			expanded.WriteString(strconv.FormatInt(m.Time.Unix(), 10))
+		case 'i':
+			expanded.WriteString(url.QueryEscape(modemName))
+		case 'I':
+			expanded.WriteString(url.QueryEscape(m.ID))
+		case 'd':
+			expanded.WriteString(strconv.Itoa(dlr))
+		case '%':
+			expanded.WriteByte('%')
+		default:
+			// not an escape, eg already url encoded
+			expanded.WriteByte('%')
+			expanded.WriteByte(template[i])
+		}
+	}
+	return expanded.String()
+}
+
+// notifyKannel fetches a get-url for an inbound message.  As with Kannel, a
+// plain text response is sent back to the sender.
+func notifyKannel(db *gorm.DB, m *Message, template string) error {
+	res, err := http.Get(expandKannelURL(template, m, m.Modem, 0))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil
+	}
+	m.Handled = true
+	db.Save(m)
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, kannelMaxReplyBytes))
+	if err != nil {
+		return err
+	}
+	reply := strings.TrimSpace(string(body))
+	if reply == "" {
+		return nil
+	}
+	return enqueueReply(db, m, &Message{Body: truncateBody(reply, maxBodyLength)}, 0)
+}
+
+// kannelDLR returns the dlr-mask bit for a message status, or 0 if the status
+// isn't reported
+func kannelDLR(status string) int {
+	switch status {
+	case StatusScheduled, StatusDelayed:
+		return kannelQueued
+	case StatusSent:
+		return kannelSMSCSubmit
+	case StatusFailed:
+		return kannelSMSCRejected
+	case StatusSuppressed, StatusCancelled:
+		return kannelUndelivered
+	}
+	return 0
+}
+
+func createSendSMSHandler(db *gorm.DB, format *numberFormat, username string, password string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reply := func(status int, text string) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(status)
+			fmt.Fprint(w, text)
+		}
+
+		if err := r.ParseForm(); err != nil {
+			reply(http.StatusBadRequest, "Could not parse request")
+			return
+		}
+
+		givenUsername := r.Form.Get("username")
+		if givenUsername == "" {
+			givenUsername = r.Form.Get("user")
+		}
+		givenPassword := r.Form.Get("password")
+		if givenPassword == "" {
+			givenPassword = r.Form.Get("pass")
+		}
+		if givenUsername != username || subtle.ConstantTimeCompare([]byte(givenPassword), []byte(password)) != 1 {
+			reply(http.StatusForbidden, "Authorization failed for sendsms")
+			return
+		}
+
+		to := strings.Fields(r.Form.Get("to"))
+		text := r.Form.Get("text")
+		if len(to) == 0 {
+			reply(http.StatusBadRequest, "Missing receiver number")
+			return
+		}
+		if text == "" {
+			reply(http.StatusBadRequest, "Missing text")
+			return
+		}
+		dlrMask, _ := strconv.Atoi(r.Form.Get("dlr-mask"))
+
+		// multiple receivers are separated by spaces
+		for _, number := range to {
+			m := Message{
+				Number:  number,
+				Body:    text,
+				DlrURL:  r.Form.Get("dlr-url"),
+				DlrMask: dlrMask,
+			}
+			if err := enqueueMessage(db, format, &m); err != nil {
+				log.Printf("Rejected sendsms to %v: %v\n", number, err)
+				if _, ok := err.(invalidMessageError); ok || err == errSuppressed {
+					reply(http.StatusBadRequest, err.Error())
+				} else {
+					reply(http.StatusServiceUnavailable, "Sending failed")
+				}
+				return
+			}
+		}
+
+		reply(http.StatusAccepted, "0: Accepted for delivery")
+	}
+}
+
+func listenOnKannel(db *gorm.DB, format *numberFormat, username string, password string, modemName string) chan error {
+	errorChannel := make(chan error, 1)
+
+	// anyone who can reach the port could send through the SIM
+	if password == "" {
+		errorChannel <- errors.New("Not accepting Kannel sendsms requests without KANNEL_PASSWORD")
+		return errorChannel
+	}
+
+	http.HandleFunc("/cgi-bin/sendsms", createSendSMSHandler(db, format, username, password))
+
+	// delivery reports
+	go events.follow(0, eventTypes(EventStatus), nil, func(e Event) error {
+		m, ok := e.Data.(Message)
+		if !ok || m.DlrURL == "" {
+			return nil
+		}
+		dlr := kannelDLR(m.Status)
+		if dlr&m.DlrMask == 0 {
+			return nil
+		}
+
+		res, err := http.Get(expandKannelURL(m.DlrURL, &m, modemName, dlr))
+		if err != nil {
+			errorChannel <- err
+			return nil
+		}
+		res.Body.Close()
+		return nil
+	})
+
+	return errorChannel
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExpandKannelURL(t *testing.T) {
+	Convey("Expanding get-url escapes", t, func() {
+		m := &Message{
+			ID:       "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+			Number:   "+15555555555",
+			Body:     "Balance  please",
+			Incoming: true,
+			Time:     time.Date(2018, 4, 28, 20, 56, 7, 0, time.UTC),
+		}
+
+		Convey("should fill in the sender, receiver and text", func() {
+			url := expandKannelURL("http://app/sms?from=%p&to=%P&text=%a&kw=%k&ts=%T", m, "sim1", 0)
+			So(url, ShouldEqual, "http://app/sms?from=%2B15555555555&to=sim1&text=Balance+please&kw=balance&ts=1524948967")
+		})
+
+		Convey("should leave url encoding alone", func() {
+			url := expandKannelURL("http://app/sms?q=a%20b&id=%I", m, "sim1", 0)
+			So(url, ShouldEqual, "http://app/sms?q=a%20b&id=6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+		})
+
+		Convey("should fill in the delivery report type", func() {
+			m.Incoming = false
+			url := expandKannelURL("http://app/dlr?to=%p&type=%d", m, "sim1", kannelSMSCSubmit)
+			So(url, ShouldEqual, "http://app/dlr?to=%2B15555555555&type=8")
+		})
+	})
+}
+
+func TestListenOnKannel(t *testing.T) {
+	Convey("Starting without a password", t, func() {
+		err := <-listenOnKannel(nil, nil, "gateway", "", "test")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/barnybug/gogsmmodem"
@@ -12,52 +15,200 @@ import (
 	"github.com/tarm/serial"
 )
 
-func main() {
-	device := os.Getenv("DEVICE")
-	port := os.Getenv("PORT")
-	notificationUrl := os.Getenv("NOTIFICATION_URL")
+func envOrDefault(key string, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
 
+func pgConnectionString() string {
 	pgHost := os.Getenv("PGHOST")
 	pgUser := os.Getenv("PGUSER")
 	pgPassword := os.Getenv("PGPASSWORD")
 	pgDatabase := os.Getenv("PGDATABASE")
 
-	pgConnectionString := fmt.Sprintf("postgresql://%v:%v@%v/%v?sslmode=disable", pgUser, pgPassword, pgHost, pgDatabase)
+	return fmt.Sprintf("postgresql://%v:%v@%v/%v?sslmode=disable", pgUser, pgPassword, pgHost, pgDatabase)
+}
+
+func main() {
+	// anything other than serve is a client command
+	if len(os.Args) > 1 && os.Args[1] != "serve" {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
+	device := os.Getenv("DEVICE")
+	port := os.Getenv("PORT")
+	notification := &Route{URL: os.Getenv("NOTIFICATION_URL"), Format: envOrDefault("NOTIFICATION_FORMAT", FormatJSON)}
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	apiKeysRequired := os.Getenv("API_KEYS_REQUIRED") == "true"
+	console := newATConsole(os.Getenv("AT_ALLOW"), os.Getenv("AT_DENY"))
+	transcriptMaxBytes, _ := strconv.ParseInt(envOrDefault("TRANSCRIPT_MAX_BYTES", "10485760"), 10, 64)
+	transcriptKeep, _ := strconv.Atoi(envOrDefault("TRANSCRIPT_KEEP", "10"))
+	recorder := newTranscriptRecorder(envOrDefault("TRANSCRIPT_DIR", "transcripts"), transcriptMaxBytes, transcriptKeep)
+	if os.Getenv("TRANSCRIPT_ENABLED") == "true" {
+		if err := recorder.setEnabled(true); err != nil {
+			log.Println(err.Error())
+		}
+	}
+	idempotencyRetentionHours, _ := strconv.Atoi(envOrDefault("IDEMPOTENCY_RETENTION_HOURS", "24"))
+
+	modemName := envOrDefault("MODEM_NAME", device)
+	ratePerMinute, _ := strconv.Atoi(os.Getenv("RATE_PER_MINUTE"))
+	ratePerNumberPerHour, _ := strconv.Atoi(os.Getenv("RATE_PER_NUMBER_PER_HOUR"))
+	dailyCap, _ := strconv.Atoi(os.Getenv("DAILY_CAP"))
+
+	mqttQos, _ := strconv.Atoi(os.Getenv("MQTT_QOS"))
+	mqtt := &mqttConfig{
+		url:          os.Getenv("MQTT_URL"),
+		clientID:     envOrDefault("MQTT_CLIENT_ID", "gsm-gateway"),
+		inboundTopic: envOrDefault("MQTT_INBOUND_TOPIC", "sms/inbound"),
+		sendTopic:    envOrDefault("MQTT_SEND_TOPIC", "sms/send"),
+		statusTopic:  envOrDefault("MQTT_STATUS_TOPIC", "sms/status"),
+		qos:          byte(mqttQos),
+	}
+
+	grpcPort := os.Getenv("GRPC_PORT")
+
+	smppPort := os.Getenv("SMPP_PORT")
+	smppSystemID := envOrDefault("SMPP_SYSTEM_ID", "gsm-gateway")
+	smppPassword := os.Getenv("SMPP_PASSWORD")
+
+	email := &emailConfig{
+		port:            os.Getenv("SMTP_PORT"),
+		domain:          envOrDefault("EMAIL_DOMAIN", "sms.local"),
+		allowedNetworks: strings.Split(envOrDefault("EMAIL_ALLOWED_NETWORKS", "127.0.0.0/8,::1"), ","),
+		allowedSenders:  strings.Split(os.Getenv("EMAIL_ALLOWED_SENDERS"), ","),
+		bodyMode:        envOrDefault("EMAIL_BODY_MODE", "both"),
+		relay:           os.Getenv("SMTP_RELAY"),
+		username:        os.Getenv("SMTP_USERNAME"),
+		password:        os.Getenv("SMTP_PASSWORD"),
+		from:            envOrDefault("EMAIL_FROM", "gsm-gateway@sms.local"),
+		forward:         os.Getenv("EMAIL_FORWARD_TO"),
+	}
+
+	twilioAccountSid := os.Getenv("TWILIO_ACCOUNT_SID")
+	twilioAuthToken := os.Getenv("TWILIO_AUTH_TOKEN")
+
+	kannelUsername := os.Getenv("KANNEL_USERNAME")
+	kannelPassword := os.Getenv("KANNEL_PASSWORD")
+
+	spoolOutgoing := os.Getenv("SPOOL_OUTGOING")
+	spoolParent := filepath.Dir(spoolOutgoing)
+	spool := &spoolConfig{
+		outgoing: spoolOutgoing,
+		checked:  envOrDefault("SPOOL_CHECKED", filepath.Join(spoolParent, "checked")),
+		sent:     envOrDefault("SPOOL_SENT", filepath.Join(spoolParent, "sent")),
+		failed:   envOrDefault("SPOOL_FAILED", filepath.Join(spoolParent, "failed")),
+		incoming: os.Getenv("SPOOL_INCOMING"),
+	}
+
+	outboxEnabled := os.Getenv("OUTBOX_ENABLED") == "true"
+	outboxPollSeconds, _ := strconv.Atoi(envOrDefault("OUTBOX_POLL_SECONDS", "10"))
+
+	format := newNumberFormat(os.Getenv("DEFAULT_COUNTRY_CODE"), os.Getenv("NATIONAL_PREFIX"), os.Getenv("INTERNATIONAL_PREFIX"))
+
+	connectionString := pgConnectionString()
 
 	log.Printf("Initializing gateway with time zone %v", time.Now().Location().String())
 
 	// set up db
-	log.Printf("Connecting to db at %v", pgConnectionString)
-	db, dbErr := gorm.Open("postgres", pgConnectionString)
+	log.Printf("Connecting to db at %v", connectionString)
+	db, dbErr := gorm.Open("postgres", connectionString)
 	if dbErr != nil {
 		panic(dbErr.Error())
 	}
 	defer db.Close()
-	db.AutoMigrate(&Message{})
+	db.AutoMigrate(&Message{}, &Schedule{}, &Suppression{}, &Route{}, &AutoResponse{}, &Campaign{}, &Template{}, &APIKey{}, &IdempotencyKey{}, &ATCommand{})
 
 	// set up modem
 	serialPort, portErr := serial.OpenPort(&serial.Config{Name: device, Baud: 115200})
 	if portErr != nil {
 		panic(portErr)
 	}
-	modem, modemErr := gogsmmodem.NewModem(serialPort, gogsmmodem.NewSerialModemConfig())
+	// recorded while the transcript is switched on
+	recordedPort := &transcriptPort{port: serialPort, recorder: recorder}
+	// lets the gateway run commands gogsmmodem has no method for
+	commands := newCommandPort(recordedPort)
+	modem, modemErr := gogsmmodem.NewModem(commands, gogsmmodem.NewSerialModemConfig())
 	if modemErr != nil {
 		panic(modemErr)
 	}
 	defer modem.Close()
 
-	modemError := listenOnModem(db, modem, notificationUrl)
+	modemError := listenOnModem(db, modem, commands, modemName, format, notification)
 	defer close(modemError)
 
-	httpError := listenOnHTTP(db, modem, port)
+	limiter := newRateLimiter(ratePerMinute, ratePerNumberPerHour, dailyCap, modemName)
+
+	queueError := listenOnQueue(db, modem, limiter)
+	defer close(queueError)
+
+	httpError := listenOnHTTP(db, modem, commands, limiter, format, adminToken, apiKeysRequired, time.Duration(idempotencyRetentionHours)*time.Hour, console, recorder, port)
 	defer close(httpError)
 
+	// optional bridges
+	var grpcError chan error
+	if grpcPort != "" {
+		grpcError = listenOnGRPC(db, modem, limiter, format, adminToken, apiKeysRequired, grpcPort)
+	}
+
+	var mqttError chan error
+	if mqtt.url != "" {
+		mqttError = listenOnMQTT(db, format, mqtt)
+	}
+
+	var smppError chan error
+	if smppPort != "" {
+		smppError = listenOnSMPP(db, format, smppPort, smppSystemID, smppPassword, modemName)
+	}
+
+	emailError := listenOnEmail(db, format, email)
+
+	var twilioError chan error
+	if twilioAccountSid != "" && twilioAuthToken != "" {
+		twilioError = listenOnTwilio(db, format, twilioAccountSid, twilioAuthToken, modemName)
+	}
+
+	var kannelError chan error
+	if kannelUsername != "" {
+		kannelError = listenOnKannel(db, format, kannelUsername, kannelPassword, modemName)
+	}
+
+	var spoolError chan error
+	if spool.outgoing != "" || spool.incoming != "" {
+		spoolError = listenOnSpool(db, format, spool)
+	}
+
+	var outboxError chan error
+	if outboxEnabled {
+		outboxError = listenOnOutbox(db, format, connectionString, time.Duration(outboxPollSeconds)*time.Second)
+	}
+
 	for {
 		select {
 		case err := <-modemError:
 			log.Println(err.Error())
+		case err := <-queueError:
+			log.Println(err.Error())
 		case err := <-httpError:
 			log.Println(err.Error())
+		case err := <-grpcError:
+			log.Println(err.Error())
+		case err := <-mqttError:
+			log.Println(err.Error())
+		case err := <-smppError:
+			log.Println(err.Error())
+		case err := <-emailError:
+			log.Println(err.Error())
+		case err := <-twilioError:
+			log.Println(err.Error())
+		case err := <-kannelError:
+			log.Println(err.Error())
+		case err := <-spoolError:
+			log.Println(err.Error())
+		case err := <-outboxError:
+			log.Println(err.Error())
 		}
 	}
 }
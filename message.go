@@ -1,22 +1,103 @@
 package main
 
 import (
+	"fmt"
+	"strings"
 	"time"
 )
 
+const (
+	StatusReceived   = "received"
+	StatusScheduled  = "scheduled"
+	StatusDelayed    = "delayed"
+	StatusSending    = "sending"
+	StatusSent       = "sent"
+	StatusFailed     = "failed"
+	StatusCancelled  = "cancelled"
+	StatusSuppressed = "suppressed"
+	StatusPaused     = "paused"
+)
+
+// the modem sends in text mode, so bodies are limited to a single message in
+// the GSM 03.38 alphabet
+const maxBodyLength = 160
+
+const gsmBasicCharacters = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// extension characters take two septets
+const gsmExtensionCharacters = "€[\\]^{|}~"
+
 type Message struct {
-	ID        string    `gorm:"primary_key,size:32" json:"id"`
-	Number    string    `gorm:"size:32" json:"number"`
-	Body      string    `gorm:"size:160" json:"body"`
-	Incoming  bool      `gorm:"index" json:"-"`
-	Handled   bool      `gorm:"index" json:"-"`
-	Time      time.Time `json:"time"`
-	CreatedAt time.Time `json:"-"`
-	UpdatedAt time.Time `json:"-"`
+	ID             string            `gorm:"primary_key,size:32" json:"id"`
+	Number         string            `gorm:"size:32;index" json:"number"`
+	Body           string            `gorm:"size:160" json:"body"`
+	Incoming       bool              `gorm:"index" json:"-"`
+	Handled        bool              `gorm:"index" json:"-"`
+	Status         string            `gorm:"size:16;index" json:"status"`
+	SendAt         *time.Time        `gorm:"index" json:"send_at,omitempty"`
+	ScheduleID     string            `gorm:"index" json:"schedule_id,omitempty"`
+	DelayReason    string            `json:"delay_reason,omitempty"`
+	Modem          string            `gorm:"size:32;index" json:"modem,omitempty"`
+	ConversationID string            `gorm:"index" json:"conversation_id,omitempty"`
+	AutoResponseID string            `gorm:"index" json:"auto_response_id,omitempty"`
+	CampaignID     string            `gorm:"index" json:"campaign_id,omitempty"`
+	TemplateID     string            `gorm:"index" json:"template_id,omitempty"`
+	Variables      map[string]string `gorm:"-" json:"variables,omitempty"`
+	StatusCallback string            `gorm:"size:255" json:"-"`
+	DlrURL         string            `gorm:"size:255" json:"-"`
+	DlrMask        int               `json:"-"`
+	SpoolFile      string            `gorm:"size:255" json:"-"`
+	OutboxID       uint              `gorm:"index" json:"-"`
+	Time           time.Time         `json:"time"`
+	CreatedAt      time.Time         `json:"-"`
+	UpdatedAt      time.Time         `json:"-"`
 }
 
+// queuedStatuses are those of outbound messages waiting to be sent by the queue
+var queuedStatuses = []string{StatusScheduled, StatusDelayed}
+
 func readTimeAsUTC(localTime time.Time, location *time.Location) time.Time {
 	str := localTime.Format("2006/01/02,15:04:05")
 	t, _ := time.ParseInLocation("2006/01/02,15:04:05", str, location)
 	return t.UTC()
 }
+
+// validateBody checks a body can be sent by the modem as a single message
+func validateBody(body string) error {
+	if body == "" {
+		return fmt.Errorf("Missing body")
+	}
+
+	length := 0
+	for _, c := range body {
+		if strings.ContainsRune(gsmBasicCharacters, c) {
+			length++
+		} else if strings.ContainsRune(gsmExtensionCharacters, c) {
+			length += 2
+		} else {
+			return fmt.Errorf("Unsupported character %q", c)
+		}
+	}
+
+	if length > maxBodyLength {
+		return fmt.Errorf("Body is %v characters, the limit is %v", length, maxBodyLength)
+	}
+	return nil
+}
+
+// truncateBody shortens body to fit in length septets
+func truncateBody(body string, length int) string {
+	used := 0
+	for i, c := range body {
+		if strings.ContainsRune(gsmExtensionCharacters, c) {
+			used += 2
+		} else {
+			used++
+		}
+		if used > length {
+			return body[:i]
+		}
+	}
+	return body
+}
@@ -3,8 +3,12 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/barnybug/gogsmmodem"
@@ -12,29 +16,186 @@ import (
 	"github.com/jinzhu/gorm"
 )
 
-func saveAndDelete(db *gorm.DB, modem *gogsmmodem.Modem, msg *gogsmmodem.Message, notificationUrl string) error {
+// webhookReply is the optional json response from a notification webhook
+type webhookReply struct {
+	Body  string `json:"body"`
+	Delay int    `json:"delay"`
+}
+
+// modemStatus is the last service and network status reported by the modem,
+// and the signal and storage from the last health check
+type modemStatus struct {
+	Modem           string    `json:"modem"`
+	Service         string    `json:"service"`
+	Network         string    `json:"network"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	SignalDBM       *int      `json:"signal_dbm,omitempty"`
+	StorageUsed     int       `json:"storage_used"`
+	StorageTotal    int       `json:"storage_total"`
+	HealthCheckedAt time.Time `json:"health_checked_at"`
+}
+
+// responseArgs returns the comma separated arguments of the response line
+// for command, eg 20 and 99 for +CSQ: 20,99
+func responseArgs(lines []string, command string) ([]string, error) {
+	for _, line := range lines {
+		if strings.HasPrefix(line, command+":") {
+			args := strings.Split(strings.TrimSpace(strings.TrimPrefix(line, command+":")), ",")
+			for i := range args {
+				args[i] = strings.Trim(args[i], `" `)
+			}
+			return args, nil
+		}
+	}
+	return nil, fmt.Errorf("No %v in response %q", command, lines)
+}
+
+// parseSignal converts a +CSQ response to dBm, nil when unknown
+func parseSignal(lines []string) (*int, error) {
+	args, err := responseArgs(lines, "+CSQ")
+	if err != nil {
+		return nil, err
+	}
+	rssi, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if rssi < 0 || rssi > 31 {
+		return nil, nil
+	}
+	dbm := -113 + 2*rssi
+	return &dbm, nil
+}
+
+// parseStorage reads the used and total space of the first memory from a
+// +CPMS? response
+func parseStorage(lines []string) (int, int, error) {
+	args, err := responseArgs(lines, "+CPMS")
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(args) < 3 {
+		return 0, 0, fmt.Errorf("Unexpected storage response %q", lines)
+	}
+	used, err := strconv.Atoi(args[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	total, err := strconv.Atoi(args[2])
+	if err != nil {
+		return 0, 0, err
+	}
+	return used, total, nil
+}
+
+// checkModemHealth asks the modem for its signal and storage
+func checkModemHealth(commands *commandPort) error {
+	modemMutex.Lock()
+	signalLines, signalErr := commands.run("AT+CSQ")
+	storageLines, storageErr := commands.run("AT+CPMS?")
+	modemMutex.Unlock()
+	if signalErr != nil {
+		return signalErr
+	}
+	if storageErr != nil {
+		return storageErr
+	}
+
+	signal, err := parseSignal(signalLines)
+	if err != nil {
+		return err
+	}
+	used, total, err := parseStorage(storageLines)
+	if err != nil {
+		return err
+	}
+
+	modemStatusMutex.Lock()
+	defer modemStatusMutex.Unlock()
+	currentModemStatus.SignalDBM = signal
+	currentModemStatus.StorageUsed = used
+	currentModemStatus.StorageTotal = total
+	currentModemStatus.HealthCheckedAt = time.Now().UTC()
+	return nil
+}
+
+var (
+	currentModemStatus modemStatus
+	modemStatusMutex   sync.Mutex
+)
+
+func updateModemStatus(update func(s *modemStatus)) {
+	modemStatusMutex.Lock()
+	defer modemStatusMutex.Unlock()
+
+	update(&currentModemStatus)
+	currentModemStatus.UpdatedAt = time.Now().UTC()
+}
+
+func getModemStatus() modemStatus {
+	modemStatusMutex.Lock()
+	defer modemStatusMutex.Unlock()
+
+	return currentModemStatus
+}
+
+func saveAndDelete(db *gorm.DB, modem *gogsmmodem.Modem, modemName string, format *numberFormat, msg *gogsmmodem.Message, notification *Route) error {
 	message := Message{
 		ID:       uuid.New().String(),
-		Number:   msg.Telephone,
+		Number:   format.normalizeSender(msg.Telephone),
 		Body:     msg.Body,
 		Incoming: true,
+		Status:   StatusReceived,
+		Modem:    modemName,
 		Time:     readTimeAsUTC(msg.Timestamp, time.Now().Location()),
 	}
 
 	// store message
-	db.Create(&message)
+	if err := db.Create(&message).Error; err != nil {
+		return err
+	}
+	publishMessage(&message)
+	optOutErr := handleOptOut(db, &message)
+	if optOutErr != nil {
+		return optOutErr
+	}
+
+	modemMutex.Lock()
 	deleteErr := modem.DeleteMessage(msg.Index)
+	modemMutex.Unlock()
 	if deleteErr != nil {
 		return deleteErr
 	}
 
+	// built in rules may answer instead of the webhook
+	exclusive, autoRespondErr := autoRespond(db, &message)
+	if autoRespondErr != nil {
+		return autoRespondErr
+	}
+	if exclusive {
+		message.Handled = true
+		db.Save(&message)
+		return nil
+	}
+
+	route, routeErr := routeMessage(db, &message, notification)
+	if routeErr != nil {
+		return routeErr
+	}
+	if route.URL == "" {
+		return nil
+	}
+	if route.Format == FormatKannel {
+		return notifyKannel(db, &message, route.URL)
+	}
+
 	str, marshalErr := json.Marshal(&message)
 	if marshalErr != nil {
 		return marshalErr
 	}
 
 	// post result
-	res, err := http.Post(notificationUrl, "application/json", bytes.NewBuffer(str))
+	res, err := http.Post(route.URL, "application/json", bytes.NewBuffer(str))
 	if err != nil {
 		return err
 	}
@@ -44,45 +205,79 @@ func saveAndDelete(db *gorm.DB, modem *gogsmmodem.Modem, msg *gogsmmodem.Message
 		// update handled
 		message.Handled = true
 		db.Save(&message)
+
+		// the webhook may answer with a reply to send back
+		var reply webhookReply
+		if json.NewDecoder(res.Body).Decode(&reply) == nil && reply.Body != "" {
+			return enqueueReply(db, &message, &Message{Body: reply.Body}, time.Duration(reply.Delay)*time.Second)
+		}
 	}
 
 	return nil
 }
 
-func listenOnModem(db *gorm.DB, modem *gogsmmodem.Modem, notificationUrl string) chan error {
+// modemHealthInterval is how often signal and storage are checked
+const modemHealthInterval = 30 * time.Second
+
+func listenOnModem(db *gorm.DB, modem *gogsmmodem.Modem, commands *commandPort, modemName string, format *numberFormat, notification *Route) chan error {
 	errorChannel := make(chan error, 1)
 
+	updateModemStatus(func(s *modemStatus) { s.Modem = modemName })
+
 	go func() {
 		// retrieve old messages
+		modemMutex.Lock()
 		msgs, err := modem.ListMessages("ALL")
+		modemMutex.Unlock()
 		if err != nil {
 			errorChannel <- err
 			return
 		}
 
 		for _, msg := range []gogsmmodem.Message(*msgs) {
-			err := saveAndDelete(db, modem, &msg, notificationUrl)
+			err := saveAndDelete(db, modem, modemName, format, &msg, notification)
 			if err != nil {
 				errorChannel <- err
 			}
 		}
 
+		// checked in the background so status requests never wait on the
+		// modem, starting once old messages are out of the way
+		go func() {
+			ticker := time.NewTicker(modemHealthInterval)
+			defer ticker.Stop()
+			for {
+				if err := checkModemHealth(commands); err != nil {
+					errorChannel <- fmt.Errorf("Failed to check modem health: %v", err)
+				}
+				<-ticker.C
+			}
+		}()
+
 		for {
 			for packet := range modem.OOB {
 				switch p := packet.(type) {
 				case gogsmmodem.MessageNotification:
+					modemMutex.Lock()
 					msg, err := modem.GetMessage(p.Index)
+					modemMutex.Unlock()
 					if err != nil {
 						errorChannel <- err
 						continue
 					}
 					log.Printf("Received message %v: %v\n", msg.Telephone, msg.Body)
 
-					saveErr := saveAndDelete(db, modem, msg, notificationUrl)
+					saveErr := saveAndDelete(db, modem, modemName, format, msg, notification)
 					if saveErr != nil {
 						errorChannel <- saveErr
 						continue
 					}
+				case gogsmmodem.ServiceStatus:
+					updateModemStatus(func(s *modemStatus) { s.Service = p.Status })
+					events.publish(EventModem, "", map[string]string{"modem": modemName, "service": p.Status})
+				case gogsmmodem.NetworkStatus:
+					updateModemStatus(func(s *modemStatus) { s.Network = p.Network })
+					events.publish(EventModem, "", map[string]string{"modem": modemName, "network": p.Network})
 				}
 			}
 
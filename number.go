@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// minInternationalLength is the fewest digits, including the country code, of
+// a number without + or the international prefix which may be taken as
+// already international
+const minInternationalLength = 11
+
+// numberFormat normalizes phone numbers to E.164.  Numbers without a leading
+// + or the international prefix are national numbers in the default country,
+// or already include their country code when no default is configured.
+type numberFormat struct {
+	countryCode         string
+	nationalPrefix      string
+	internationalPrefix string
+}
+
+func newNumberFormat(countryCode, nationalPrefix, internationalPrefix string) *numberFormat {
+	return &numberFormat{
+		countryCode:         strings.TrimPrefix(countryCode, "+"),
+		nationalPrefix:      nationalPrefix,
+		internationalPrefix: internationalPrefix,
+	}
+}
+
+func (f *numberFormat) normalize(number string) (string, error) {
+	// drop formatting characters
+	digits := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')', '\t':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(number))
+
+	if strings.HasPrefix(digits, "+") {
+		digits = digits[1:]
+	} else if f.internationalPrefix != "" && strings.HasPrefix(digits, f.internationalPrefix) {
+		digits = digits[len(f.internationalPrefix):]
+	} else if f.countryCode != "" {
+		switch {
+		case f.nationalPrefix != "" && strings.HasPrefix(digits, f.nationalPrefix):
+			digits = f.countryCode + digits[len(f.nationalPrefix):]
+		case strings.HasPrefix(digits, f.countryCode):
+			// an international number written without the +, or a national
+			// number which happens to start with the country code
+			if len(digits) < minInternationalLength {
+				return "", fmt.Errorf("Ambiguous phone number %q, include the + and country code", number)
+			}
+		default:
+			digits = f.countryCode + digits
+		}
+	}
+
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("Invalid phone number %q", number)
+		}
+	}
+	if len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return "", fmt.Errorf("Invalid phone number %q", number)
+	}
+
+	return "+" + digits, nil
+}
+
+// normalizeSender normalizes inbound numbers where possible, keeping short
+// codes and alphanumeric sender ids as they are
+func (f *numberFormat) normalizeSender(number string) string {
+	normalized, err := f.normalize(number)
+	if err != nil {
+		return number
+	}
+	return normalized
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNormalizeNumber(t *testing.T) {
+	Convey("Normalizing north american numbers", t, func() {
+		format := newNumberFormat("1", "1", "011")
+
+		Convey("should accept the same number in every form", func() {
+			for _, number := range []string{"+15555555555", "15555555555", "5555555555", "(555) 555-5555", "01115555555555"} {
+				normalized, err := format.normalize(number)
+				So(err, ShouldBeNil)
+				So(normalized, ShouldEqual, "+15555555555")
+			}
+		})
+
+		Convey("should keep international numbers", func() {
+			normalized, err := format.normalize("011 44 20 7946 0018")
+			So(err, ShouldBeNil)
+			So(normalized, ShouldEqual, "+442079460018")
+		})
+
+		Convey("should reject impossible numbers", func() {
+			for _, number := range []string{"555", "+1555555555555555", "call me", "+0123456789"} {
+				_, err := format.normalize(number)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+
+	Convey("Normalizing UK numbers", t, func() {
+		format := newNumberFormat("44", "0", "00")
+
+		Convey("should accept the same number in every form", func() {
+			for _, number := range []string{"+447911123456", "07911 123456", "7911123456", "00447911123456"} {
+				normalized, err := format.normalize(number)
+				So(err, ShouldBeNil)
+				So(normalized, ShouldEqual, "+447911123456")
+			}
+		})
+
+		Convey("should not add the country code twice", func() {
+			normalized, err := format.normalize("447911123456")
+			So(err, ShouldBeNil)
+			So(normalized, ShouldEqual, "+447911123456")
+		})
+
+		Convey("should reject numbers which could be either", func() {
+			_, err := format.normalize("4479111234")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Normalizing German numbers", t, func() {
+		format := newNumberFormat("49", "0", "00")
+
+		Convey("should accept national and international forms", func() {
+			for _, number := range []string{"030 1234567", "+49 30 1234567", "49301234567", "0049 30 1234567"} {
+				normalized, err := format.normalize(number)
+				So(err, ShouldBeNil)
+				So(normalized, ShouldEqual, "+49301234567")
+			}
+		})
+	})
+
+	Convey("Normalizing without a default country", t, func() {
+		format := newNumberFormat("", "", "")
+
+		Convey("should assume the country code is included", func() {
+			normalized, err := format.normalize("447946001800")
+			So(err, ShouldBeNil)
+			So(normalized, ShouldEqual, "+447946001800")
+		})
+
+		Convey("should keep alphanumeric senders as they are", func() {
+			So(format.normalizeSender("Rogers"), ShouldEqual, "Rogers")
+		})
+	})
+}
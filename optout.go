@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// keywords recognised as the whole body of an inbound message
+var optOutKeywords = []string{"STOP", "STOPALL", "UNSUBSCRIBE", "CANCEL", "END", "QUIT"}
+var optInKeywords = []string{"START", "UNSTOP", "YES"}
+
+type Suppression struct {
+	Number    string    `gorm:"primary_key;size:32" json:"number"`
+	Reason    string    `gorm:"size:64" json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+func matchesKeyword(body string, keywords []string) bool {
+	word := strings.ToUpper(strings.Trim(body, " \t\r\n.!"))
+	for _, keyword := range keywords {
+		if word == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+// suppress adds number to the suppression list, or updates the reason of an
+// existing entry so it keeps the time the number was first suppressed
+func suppress(db *gorm.DB, number string, reason string) (Suppression, error) {
+	var s Suppression
+	err := db.Where(Suppression{Number: number}).Assign(Suppression{Reason: reason}).FirstOrCreate(&s).Error
+	return s, err
+}
+
+func isSuppressed(db *gorm.DB, number string) (bool, error) {
+	var count int
+	err := db.Model(&Suppression{}).Where("number = ?", number).Count(&count).Error
+	return count > 0, err
+}
+
+// handleOptOut updates the suppression list for opt out and opt in keywords
+func handleOptOut(db *gorm.DB, message *Message) error {
+	if matchesKeyword(message.Body, optOutKeywords) {
+		log.Printf("Suppressing %v\n", message.Number)
+		_, err := suppress(db, message.Number, "opt out: "+strings.TrimSpace(message.Body))
+		return err
+	}
+
+	if matchesKeyword(message.Body, optInKeywords) {
+		log.Printf("Unsuppressing %v\n", message.Number)
+		return db.Where("number = ?", message.Number).Delete(&Suppression{}).Error
+	}
+
+	return nil
+}
+
+func createSuppressionsHandler(db *gorm.DB, format *numberFormat) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			suppressions := []Suppression{}
+			if err := db.Order("created_at").Find(&suppressions).Error; err != nil {
+				http.Error(w, "500 Failed to list.", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, suppressions)
+		case "POST":
+			decoder := json.NewDecoder(r.Body)
+			var s Suppression
+			err := decoder.Decode(&s)
+			defer r.Body.Close()
+			if err != nil || s.Number == "" {
+				http.Error(w, "400 Bad request.", http.StatusBadRequest)
+				return
+			}
+
+			s.Number, err = format.normalize(s.Number)
+			if err != nil {
+				http.Error(w, "400 "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if s.Reason == "" {
+				s.Reason = "admin"
+			}
+			s, err = suppress(db, s.Number, s.Reason)
+			if err != nil {
+				http.Error(w, "500 Failed to save.", http.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(w, http.StatusCreated, s)
+		default:
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+	}
+}
+
+func createSuppressionHandler(db *gorm.DB, format *numberFormat) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		number := format.normalizeSender(strings.TrimPrefix(r.URL.Path, "/api/suppressions/"))
+
+		var s Suppression
+		if db.Where("number = ?", number).First(&s).RecordNotFound() {
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			writeJSON(w, http.StatusOK, s)
+		case "DELETE":
+			db.Delete(&s)
+			writeJSON(w, http.StatusOK, s)
+		default:
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+	}
+}
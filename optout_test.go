@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMatchesKeyword(t *testing.T) {
+	Convey("Matching opt out keywords", t, func() {
+		Convey("should ignore case and surrounding punctuation", func() {
+			So(matchesKeyword(" stop. ", optOutKeywords), ShouldBeTrue)
+			So(matchesKeyword("Unsubscribe!", optOutKeywords), ShouldBeTrue)
+		})
+
+		Convey("should only match the whole body", func() {
+			So(matchesKeyword("please don't stop", optOutKeywords), ShouldBeFalse)
+		})
+	})
+}
+
+func TestHandleOptOut(t *testing.T) {
+	Convey("Opting out", t, func() {
+		db, err := newTestDB()
+		So(err, ShouldBeNil)
+		defer db.Close()
+
+		first := time.Now().Add(-time.Hour)
+		So(db.Create(&Suppression{Number: "+15555550100", Reason: "admin", CreatedAt: first}).Error, ShouldBeNil)
+
+		Convey("should keep the time the number was first suppressed", func() {
+			So(handleOptOut(db, &Message{Number: "+15555550100", Body: "STOP"}), ShouldBeNil)
+
+			var s Suppression
+			So(db.Where("number = ?", "+15555550100").First(&s).Error, ShouldBeNil)
+			So(s.Reason, ShouldEqual, "opt out: STOP")
+			So(s.CreatedAt.Unix(), ShouldEqual, first.Unix())
+		})
+
+		Convey("should add numbers which weren't suppressed", func() {
+			So(handleOptOut(db, &Message{Number: "+15555550101", Body: "stop"}), ShouldBeNil)
+
+			suppressed, err := isSuppressed(db, "+15555550101")
+			So(err, ShouldBeNil)
+			So(suppressed, ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// Apps sharing the database can send by inserting into the outbox table.  An
+// insert trigger notifies the gateway, which queues the row and writes the
+// message id and status back to it.
+
+const outboxChannel = "gsm_gateway_outbox"
+
+type Outbox struct {
+	ID         uint       `gorm:"primary_key" json:"id"`
+	Number     string     `gorm:"size:32" json:"number"`
+	Body       string     `gorm:"size:160" json:"body"`
+	TemplateID string     `json:"template_id"`
+	Variables  string     `gorm:"type:jsonb" json:"variables"`
+	SendAt     *time.Time `json:"send_at"`
+	MessageID  string     `gorm:"index" json:"message_id"`
+	Status     string     `gorm:"size:16" json:"status"`
+	Error      string     `json:"error"`
+	CreatedAt  time.Time  `json:"-"`
+	UpdatedAt  time.Time  `json:"-"`
+}
+
+func (Outbox) TableName() string {
+	return "outbox"
+}
+
+func migrateOutbox(db *gorm.DB) error {
+	if err := db.AutoMigrate(&Outbox{}).Error; err != nil {
+		return err
+	}
+
+	// let inserts leave out bookkeeping columns
+	for _, column := range []string{"created_at", "updated_at"} {
+		if err := db.Exec("ALTER TABLE outbox ALTER COLUMN " + column + " SET DEFAULT now()").Error; err != nil {
+			return err
+		}
+	}
+
+	err := db.Exec(`CREATE OR REPLACE FUNCTION gsm_gateway_outbox_notify() RETURNS trigger AS $$
+BEGIN
+	PERFORM pg_notify('` + outboxChannel + `', NEW.id::text);
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql`).Error
+	if err != nil {
+		return err
+	}
+	if err := db.Exec("DROP TRIGGER IF EXISTS outbox_notify ON outbox").Error; err != nil {
+		return err
+	}
+	return db.Exec("CREATE TRIGGER outbox_notify AFTER INSERT ON outbox FOR EACH ROW EXECUTE PROCEDURE gsm_gateway_outbox_notify()").Error
+}
+
+// processOutbox queues outbox rows which haven't been picked up yet
+func processOutbox(db *gorm.DB, format *numberFormat) error {
+	var rows []Outbox
+	err := db.Where("(message_id IS NULL OR message_id = '') AND (status IS NULL OR status = '')").Order("id").Find(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		m := Message{
+			Number:     row.Number,
+			Body:       row.Body,
+			TemplateID: row.TemplateID,
+			SendAt:     row.SendAt,
+			OutboxID:   row.ID,
+		}
+
+		// the message and the row's message_id are stored together, so a
+		// failure between them can't queue the row twice
+		tx := db.Begin()
+		var err error
+		if row.Variables != "" {
+			if jsonErr := json.Unmarshal([]byte(row.Variables), &m.Variables); jsonErr != nil {
+				err = invalidMessageError{fmt.Errorf("Invalid variables: %v", jsonErr)}
+			}
+		}
+		if err == nil {
+			err = createScheduledMessage(tx, format, &m)
+		}
+
+		// statuses of queued messages are written back as they change
+		update := map[string]interface{}{"message_id": m.ID}
+		if err == errSuppressed {
+			update = map[string]interface{}{"status": StatusSuppressed, "error": err.Error()}
+		} else if _, ok := err.(invalidMessageError); ok {
+			update = map[string]interface{}{"status": StatusFailed, "error": err.Error()}
+		} else if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Model(&row).Updates(update).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit().Error; err != nil {
+			return err
+		}
+
+		if m.Status == StatusScheduled {
+			publishMessage(&m)
+		}
+	}
+
+	return nil
+}
+
+func listenOnOutbox(db *gorm.DB, format *numberFormat, connectionString string, pollInterval time.Duration) chan error {
+	errorChannel := make(chan error, 1)
+
+	if err := migrateOutbox(db); err != nil {
+		errorChannel <- err
+		return errorChannel
+	}
+
+	listener := pq.NewListener(connectionString, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			errorChannel <- err
+		}
+	})
+	if err := listener.Listen(outboxChannel); err != nil {
+		errorChannel <- err
+	}
+
+	go func() {
+		for {
+			// notifications wake the loop, polling covers anything missed
+			// while the listener reconnects
+			select {
+			case <-listener.Notify:
+			case <-time.After(pollInterval):
+			}
+
+			if err := processOutbox(db, format); err != nil {
+				errorChannel <- err
+			}
+		}
+	}()
+
+	// write statuses back to the outbox
+	go events.follow(0, eventTypes(EventStatus), nil, func(e Event) error {
+		m, ok := e.Data.(Message)
+		if !ok || m.OutboxID == 0 {
+			return nil
+		}
+
+		err := db.Model(&Outbox{}).Where("id = ?", m.OutboxID).Updates(map[string]interface{}{
+			"message_id": m.ID,
+			"status":     m.Status,
+		}).Error
+		if err != nil {
+			errorChannel <- err
+		}
+		return nil
+	})
+
+	log.Printf("Listening for outbox inserts on %v\n", outboxChannel)
+	return errorChannel
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProcessOutbox(t *testing.T) {
+	Convey("Processing the outbox", t, func() {
+		db, err := newTestDB()
+		So(err, ShouldBeNil)
+		defer db.Close()
+		So(db.AutoMigrate(&Outbox{}).Error, ShouldBeNil)
+		So(db.Create(&Template{ID: "appointment", Name: "appointment", Body: "Hi {{name}}, see you at {{time}}"}).Error, ShouldBeNil)
+		format := newNumberFormat("1", "1", "011")
+
+		Convey("should render templates with the row's variables", func() {
+			row := Outbox{Number: "5555550100", TemplateID: "appointment", Variables: `{"name": "Sam", "time": "9am"}`}
+			So(db.Create(&row).Error, ShouldBeNil)
+
+			So(processOutbox(db, format), ShouldBeNil)
+			So(db.First(&row, row.ID).Error, ShouldBeNil)
+			So(row.MessageID, ShouldNotBeEmpty)
+			var m Message
+			So(db.Where("id = ?", row.MessageID).First(&m).Error, ShouldBeNil)
+			So(m.Body, ShouldEqual, "Hi Sam, see you at 9am")
+			So(m.OutboxID, ShouldEqual, row.ID)
+
+			Convey("and not queue the row again", func() {
+				So(processOutbox(db, format), ShouldBeNil)
+				var count int
+				db.Model(&Message{}).Count(&count)
+				So(count, ShouldEqual, 1)
+			})
+		})
+
+		Convey("should fail rows with invalid variables", func() {
+			row := Outbox{Number: "5555550100", TemplateID: "appointment", Variables: `["Sam"]`}
+			So(db.Create(&row).Error, ShouldBeNil)
+
+			So(processOutbox(db, format), ShouldBeNil)
+			So(db.First(&row, row.ID).Error, ShouldBeNil)
+			So(row.Status, ShouldEqual, StatusFailed)
+			So(row.Error, ShouldStartWith, "Invalid variables")
+			var count int
+			db.Model(&Message{}).Count(&count)
+			So(count, ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/barnybug/gogsmmodem"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// the modem can only process one command at a time
+var modemMutex sync.Mutex
+
+func sendMessage(db *gorm.DB, modem *gogsmmodem.Modem, limiter *rateLimiter, m *Message) error {
+	log.Printf("Sending message %v: %v\n", m.Number, m.Body)
+
+	modemMutex.Lock()
+	err := modem.SendMessage(m.Number, m.Body)
+	modemMutex.Unlock()
+
+	m.Time = time.Now().UTC()
+	m.Modem = limiter.modem
+	m.DelayReason = ""
+	if err != nil {
+		m.Status = StatusFailed
+		if saveErr := db.Save(m).Error; saveErr == nil {
+			publishMessage(m)
+		}
+		return err
+	}
+
+	// mark handled and update in db
+	m.Status = StatusSent
+	m.Handled = true
+	if err := db.Save(m).Error; err != nil {
+		return err
+	}
+	publishMessage(m)
+
+	return nil
+}
+
+// deferIfLimited hands m back to the queue if a rate limit blocks sending it now
+func deferIfLimited(db *gorm.DB, limiter *rateLimiter, m *Message) (bool, error) {
+	until, reason, err := limiter.delay(db, m, time.Now())
+	if err != nil {
+		return false, err
+	}
+	if until.IsZero() {
+		return false, nil
+	}
+
+	// the message may have been cancelled or paused meanwhile, leave it be
+	until = until.UTC()
+	log.Printf("Delaying message %v until %v: %v\n", m.ID, until, reason)
+	result := db.Model(&Message{}).
+		Where("id = ? AND status = ?", m.ID, m.Status).
+		Updates(map[string]interface{}{"status": StatusDelayed, "send_at": &until, "delay_reason": reason})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return true, result.Error
+	}
+
+	m.Status = StatusDelayed
+	m.SendAt = &until
+	m.DelayReason = reason
+	publishMessage(m)
+	return true, nil
+}
+
+var errSuppressed = errors.New("Number has opted out")
+
+// invalidMessageError is a problem with the message as given by the sender
+type invalidMessageError struct {
+	err error
+}
+
+func (e invalidMessageError) Error() string {
+	return e.err.Error()
+}
+
+// prepareMessage normalizes and validates a new outbound message, rendering
+// its template, and refuses numbers which have opted out
+func prepareMessage(db *gorm.DB, format *numberFormat, m *Message) error {
+	number, err := format.normalize(m.Number)
+	if err != nil {
+		return invalidMessageError{err}
+	}
+	m.Number = number
+
+	// render the template or check the body as given
+	if m.TemplateID != "" {
+		m.Body, err = renderTemplate(db, m.TemplateID, m.Variables)
+	} else {
+		err = validateBody(m.Body)
+	}
+	if err != nil {
+		return invalidMessageError{err}
+	}
+
+	suppressed, err := isSuppressed(db, m.Number)
+	if err != nil {
+		return err
+	}
+	if suppressed {
+		return errSuppressed
+	}
+
+	m.Incoming = false
+	m.ID = uuid.New().String()
+	m.Time = time.Now().UTC()
+	return nil
+}
+
+// enqueueMessage prepares a new outbound message and leaves it to the queue to
+// send, immediately or at its send_at time
+func enqueueMessage(db *gorm.DB, format *numberFormat, m *Message) error {
+	if err := createScheduledMessage(db, format, m); err != nil {
+		return err
+	}
+	publishMessage(m)
+	return nil
+}
+
+// createScheduledMessage stores a new outbound message for the queue without
+// publishing it, for callers which store it as part of a transaction
+func createScheduledMessage(db *gorm.DB, format *numberFormat, m *Message) error {
+	if err := prepareMessage(db, format, m); err != nil {
+		return err
+	}
+
+	sendAt := m.Time
+	if m.SendAt != nil && m.SendAt.After(sendAt) {
+		sendAt = m.SendAt.UTC()
+	}
+	m.SendAt = &sendAt
+	m.Status = StatusScheduled
+
+	return db.Create(m).Error
+}
+
+// submitMessage prepares a new outbound message and sends it straight away,
+// unless it is scheduled for later or held back by a rate limit.  sent is
+// false when the message was left to the queue.
+func submitMessage(db *gorm.DB, modem *gogsmmodem.Modem, limiter *rateLimiter, format *numberFormat, m *Message) (bool, error) {
+	if err := prepareMessage(db, format, m); err != nil {
+		return false, err
+	}
+
+	// hold scheduled messages for the queue
+	if m.SendAt != nil && m.SendAt.After(m.Time) {
+		sendAt := m.SendAt.UTC()
+		m.SendAt = &sendAt
+		m.Status = StatusScheduled
+		if err := db.Create(m).Error; err != nil {
+			return false, err
+		}
+		publishMessage(m)
+		return false, nil
+	}
+	// count the message against the rate limits of concurrent sends
+	m.SendAt = nil
+	m.Status = StatusSending
+	m.Modem = limiter.modem
+	if err := db.Create(m).Error; err != nil {
+		return false, err
+	}
+	publishMessage(m)
+
+	// leave messages over a rate limit to the queue
+	delayed, err := deferIfLimited(db, limiter, m)
+	if err != nil || delayed {
+		return false, err
+	}
+
+	if err := sendMessage(db, modem, limiter, m); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// enqueueReply fills in and queues a reply to an inbound message, linking the
+// two as a conversation
+func enqueueReply(db *gorm.DB, inbound *Message, reply *Message, delay time.Duration) error {
+	// a reply the modem can't send is dropped rather than failing later
+	if err := validateBody(reply.Body); err != nil {
+		return fmt.Errorf("Not replying to %v: %v", inbound.Number, err)
+	}
+
+	if inbound.ConversationID == "" {
+		inbound.ConversationID = inbound.ID
+		if err := db.Save(inbound).Error; err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().UTC()
+	sendAt := now.Add(delay)
+	reply.ID = uuid.New().String()
+	reply.Number = inbound.Number
+	reply.Status = StatusScheduled
+	reply.SendAt = &sendAt
+	reply.ConversationID = inbound.ConversationID
+	reply.Time = now
+	log.Printf("Queueing reply to %v at %v: %v\n", reply.Number, sendAt, reply.Body)
+
+	if err := db.Create(reply).Error; err != nil {
+		return err
+	}
+	publishMessage(reply)
+	return nil
+}
+
+func sendDueMessages(db *gorm.DB, modem *gogsmmodem.Modem, limiter *rateLimiter) error {
+	var messages []Message
+	err := db.Where("incoming = ? AND status IN (?) AND send_at <= ?", false, queuedStatuses, time.Now().UTC()).
+		Order("send_at").
+		Find(&messages).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range messages {
+		m := &messages[i]
+
+		// the number may have opted out since the message was queued
+		suppressed, err := isSuppressed(db, m.Number)
+		if err != nil {
+			return err
+		}
+		if suppressed {
+			result := db.Model(&Message{}).
+				Where("id = ? AND status = ?", m.ID, m.Status).
+				Update("status", StatusSuppressed)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				m.Status = StatusSuppressed
+				publishMessage(m)
+			}
+			continue
+		}
+
+		delayed, err := deferIfLimited(db, limiter, m)
+		if err != nil {
+			return err
+		}
+		if delayed {
+			continue
+		}
+
+		// claim the message so a concurrent cancel can't race the send, and
+		// count it against the rate limits while it's being sent
+		now := time.Now().UTC()
+		claim := db.Model(&Message{}).
+			Where("id = ? AND status = ?", m.ID, m.Status).
+			Updates(map[string]interface{}{"status": StatusSending, "modem": limiter.modem, "time": now})
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+		m.Status = StatusSending
+		m.Modem = limiter.modem
+		m.Time = now
+		publishMessage(m)
+
+		if err := sendMessage(db, modem, limiter, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func listenOnQueue(db *gorm.DB, modem *gogsmmodem.Modem, limiter *rateLimiter) chan error {
+	errorChannel := make(chan error, 1)
+
+	go func() {
+		for {
+			err := runDueSchedules(db)
+			if err != nil {
+				errorChannel <- err
+			}
+
+			err = sendDueMessages(db, modem, limiter)
+			if err != nil {
+				errorChannel <- err
+			}
+
+			time.Sleep(1 * time.Second)
+		}
+	}()
+
+	return errorChannel
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEnqueueReply(t *testing.T) {
+	Convey("Queueing a reply", t, func() {
+		db, err := newTestDB()
+		So(err, ShouldBeNil)
+		defer db.Close()
+
+		inbound := Message{ID: "inbound", Number: "+15555550100", Body: "hours?", Incoming: true, Status: StatusReceived}
+		So(db.Create(&inbound).Error, ShouldBeNil)
+
+		Convey("should link the reply to the conversation", func() {
+			reply := Message{Body: "9 to 5"}
+			So(enqueueReply(db, &inbound, &reply, 0), ShouldBeNil)
+			So(reply.ConversationID, ShouldEqual, "inbound")
+			So(reply.Status, ShouldEqual, StatusScheduled)
+		})
+
+		Convey("should reject a reply the modem can't send", func() {
+			So(enqueueReply(db, &inbound, &Message{Body: strings.Repeat("a", 161)}, 0), ShouldNotBeNil)
+			So(enqueueReply(db, &inbound, &Message{Body: "see you 🙂"}, 0), ShouldNotBeNil)
+
+			var count int
+			db.Model(&Message{}).Where("incoming = ?", false).Count(&count)
+			So(count, ShouldEqual, 0)
+		})
+	})
+}
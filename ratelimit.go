@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// rateLimiter paces outbound messages to keep the SIM from being throttled or
+// blocked by the carrier.  A limit of 0 disables that check.
+type rateLimiter struct {
+	perMinute        int
+	perNumberPerHour int
+	dailyCap         int
+	modem            string
+
+	mutex    sync.Mutex
+	lastSent time.Time
+}
+
+func newRateLimiter(perMinute, perNumberPerHour, dailyCap int, modem string) *rateLimiter {
+	return &rateLimiter{
+		perMinute:        perMinute,
+		perNumberPerHour: perNumberPerHour,
+		dailyCap:         dailyCap,
+		modem:            modem,
+	}
+}
+
+// sentSince finds messages sent since a time, counting those being sent
+// concurrently by other requests
+func sentSince(db *gorm.DB, since time.Time, m *Message) *gorm.DB {
+	return db.Model(&Message{}).
+		Where("incoming = ? AND status IN (?) AND time >= ?", false, []string{StatusSent, StatusSending}, since.UTC()).
+		Where("id <> ?", m.ID)
+}
+
+// delay returns the time m may be sent at and the limit responsible, or the
+// zero time if it may be sent now.  Allowing a send reserves its slot in the
+// global pacing.
+func (l *rateLimiter) delay(db *gorm.DB, m *Message, now time.Time) (time.Time, string, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.dailyCap > 0 {
+		// days are counted in the gateway's time zone
+		local := now.Local()
+		startOfDay := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+
+		var count int
+		err := sentSince(db, startOfDay, m).Where("modem = ?", l.modem).Count(&count).Error
+		if err != nil {
+			return time.Time{}, "", err
+		}
+		if count >= l.dailyCap {
+			return startOfDay.AddDate(0, 0, 1), "daily cap", nil
+		}
+	}
+
+	if l.perNumberPerHour > 0 {
+		var recent []Message
+		err := sentSince(db, now.Add(-time.Hour), m).Where("number = ?", m.Number).Order("time desc").Limit(l.perNumberPerHour).Find(&recent).Error
+		if err != nil {
+			return time.Time{}, "", err
+		}
+		if len(recent) >= l.perNumberPerHour {
+			// wait for the oldest send in the window to age out
+			return recent[len(recent)-1].Time.Add(time.Hour), "destination rate limit", nil
+		}
+	}
+
+	if l.perMinute > 0 {
+		next := l.lastSent.Add(time.Minute / time.Duration(l.perMinute))
+		if now.Before(next) {
+			return next, "global rate limit", nil
+		}
+		l.lastSent = now
+	}
+
+	return time.Time{}, "", nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRateLimit(t *testing.T) {
+	Convey("Limiting sends to a number", t, func() {
+		db, err := newTestDB()
+		So(err, ShouldBeNil)
+		defer db.Close()
+
+		limiter := newRateLimiter(0, 1, 0, "test")
+		now := time.Now().UTC()
+		m := Message{ID: "next", Number: "+15555550100", Status: StatusScheduled, SendAt: &now, Time: now}
+		So(db.Create(&m).Error, ShouldBeNil)
+
+		Convey("should count a message still being sent", func() {
+			sending := Message{ID: "sending", Number: "+15555550100", Status: StatusSending, Time: now}
+			So(db.Create(&sending).Error, ShouldBeNil)
+
+			until, reason, err := limiter.delay(db, &m, now)
+			So(err, ShouldBeNil)
+			So(reason, ShouldEqual, "destination rate limit")
+			So(until.After(now), ShouldBeTrue)
+		})
+
+		Convey("should not count the message itself", func() {
+			m.Status = StatusSending
+			db.Save(&m)
+
+			until, _, err := limiter.delay(db, &m, now)
+			So(err, ShouldBeNil)
+			So(until.IsZero(), ShouldBeTrue)
+		})
+
+		Convey("should not delay a message cancelled meanwhile", func() {
+			So(db.Create(&Message{ID: "sent", Number: "+15555550100", Status: StatusSent, Time: now}).Error, ShouldBeNil)
+			So(db.Model(&Message{}).Where("id = ?", "next").Update("status", StatusCancelled).Error, ShouldBeNil)
+
+			delayed, err := deferIfLimited(db, limiter, &m)
+			So(err, ShouldBeNil)
+			So(delayed, ShouldBeTrue)
+
+			var stored Message
+			So(db.Where("id = ?", "next").First(&stored).Error, ShouldBeNil)
+			So(stored.Status, ShouldEqual, StatusCancelled)
+		})
+	})
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/barnybug/gogsmmodem"
+	"github.com/jinzhu/gorm"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// replayHarness drives the gateway with recorded modem transcripts from
+// testdata, an in-memory database and a fake notification webhook.  The mock
+// port panics if the gateway writes anything the transcript doesn't expect.
+type replayHarness struct {
+	db            *gorm.DB
+	modem         *gogsmmodem.Modem
+	commands      *commandPort
+	mock          *gogsmmodem.MockSerialPort
+	format        *numberFormat
+	limiter       *rateLimiter
+	webhook       *httptest.Server
+	notifications chan Message
+}
+
+// newReplayHarness replays the named transcripts in order, answering webhook
+// notifications with reply
+func newReplayHarness(reply string, transcripts ...string) (*replayHarness, error) {
+	replay := []string{}
+	for _, name := range transcripts {
+		file, err := os.Open(filepath.Join("testdata", name+".transcript"))
+		if err != nil {
+			return nil, err
+		}
+		lines, err := readTranscript(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		replay = append(replay, lines...)
+	}
+
+	db, err := newTestDB()
+	if err != nil {
+		return nil, err
+	}
+
+	h := &replayHarness{
+		db:            db,
+		format:        newNumberFormat("1", "1", "011"),
+		limiter:       newRateLimiter(0, 0, 0, "test"),
+		notifications: make(chan Message, 16),
+	}
+	h.webhook = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m Message
+		json.NewDecoder(r.Body).Decode(&m)
+		h.notifications <- m
+		w.Write([]byte(reply))
+	}))
+
+	h.mock = gogsmmodem.NewMockSerialPort(replay, 10*time.Second)
+	h.commands = newCommandPort(h.mock)
+	h.modem, err = gogsmmodem.NewModem(h.commands, gogsmmodem.NewSerialModemConfig())
+	if err != nil {
+		h.webhook.Close()
+		db.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *replayHarness) listen() {
+	listenOnModem(h.db, h.modem, h.commands, "test", h.format, &Route{URL: h.webhook.URL, Format: FormatJSON})
+}
+
+// close and done hold modemMutex, as the mock port isn't safe to share with
+// a health check in progress
+func (h *replayHarness) close() {
+	modemMutex.Lock()
+	h.modem.Close()
+	modemMutex.Unlock()
+	h.webhook.Close()
+	h.db.Close()
+}
+
+func (h *replayHarness) done() bool {
+	modemMutex.Lock()
+	defer modemMutex.Unlock()
+	return h.mock.Done()
+}
+
+// eventually polls until check passes or a few seconds have gone by
+func eventually(check func() bool) bool {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if check() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return check()
+}
+
+func (h *replayHarness) nextNotification() *Message {
+	select {
+	case m := <-h.notifications:
+		return &m
+	case <-time.After(5 * time.Second):
+		return nil
+	}
+}
+
+func (h *replayHarness) postMessage(body string, headers map[string]string) *httptest.ResponseRecorder {
+	handler := createIncomingMessageHandler(h.db, h.modem, h.limiter, h.format, time.Hour)
+	req := httptest.NewRequest("POST", "/api/messages", strings.NewReader(body))
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func TestReplay(t *testing.T) {
+	if testing.Short() {
+		t.Skip("replays take a second each to initialize the modem")
+	}
+
+	Convey("Replaying an inbound message", t, func() {
+		h, err := newReplayHarness(`{"body":"9 to 5 weekdays","delay":0}`, "init", "inbound")
+		So(err, ShouldBeNil)
+		defer h.close()
+		h.listen()
+
+		notification := h.nextNotification()
+		So(notification, ShouldNotBeNil)
+		So(notification.Number, ShouldEqual, "+15555550100")
+		So(notification.Body, ShouldEqual, "what are your hours")
+
+		So(eventually(h.done), ShouldBeTrue)
+
+		var inbound Message
+		So(eventually(func() bool {
+			return !h.db.Where("incoming = ? AND handled = ?", true, true).First(&inbound).RecordNotFound()
+		}), ShouldBeTrue)
+		So(inbound.ID, ShouldEqual, notification.ID)
+		So(inbound.Status, ShouldEqual, StatusReceived)
+		So(inbound.Modem, ShouldEqual, "test")
+		// modem clocks are read in the gateway's time zone
+		So(inbound.Time, ShouldResemble, time.Date(2018, 5, 1, 9, 0, 12, 0, time.Local).UTC())
+
+		// the webhook's reply is queued as part of a conversation
+		var reply Message
+		So(eventually(func() bool {
+			return !h.db.Where("incoming = ?", false).First(&reply).RecordNotFound()
+		}), ShouldBeTrue)
+		So(reply.Body, ShouldEqual, "9 to 5 weekdays")
+		So(reply.Number, ShouldEqual, "+15555550100")
+		So(reply.Status, ShouldEqual, StatusScheduled)
+		So(reply.ConversationID, ShouldEqual, inbound.ID)
+	})
+
+	Convey("Replaying a stored opt out", t, func() {
+		h, err := newReplayHarness("", "init", "stored")
+		So(err, ShouldBeNil)
+		defer h.close()
+		h.listen()
+
+		notification := h.nextNotification()
+		So(notification, ShouldNotBeNil)
+		So(notification.Body, ShouldEqual, "STOP")
+		So(eventually(h.done), ShouldBeTrue)
+
+		So(eventually(func() bool {
+			return !h.db.Where("incoming = ? AND handled = ?", true, true).First(&Message{}).RecordNotFound()
+		}), ShouldBeTrue)
+
+		suppressed, err := isSuppressed(h.db, "+15555550100")
+		So(err, ShouldBeNil)
+		So(suppressed, ShouldBeTrue)
+
+		Convey("should refuse sends without touching the modem", func() {
+			w := h.postMessage(`{"number":"5555550100","body":"hello"}`, nil)
+			So(w.Code, ShouldEqual, http.StatusForbidden)
+		})
+	})
+
+	Convey("Replaying a send from the api", t, func() {
+		h, err := newReplayHarness("", "init", "send")
+		So(err, ShouldBeNil)
+		defer h.close()
+
+		w := h.postMessage(`{"number":"(555) 555-0100","body":"see you at 9"}`, map[string]string{"Idempotency-Key": "appointment-42"})
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(h.done(), ShouldBeTrue)
+
+		var sent Message
+		So(json.Unmarshal(w.Body.Bytes(), &sent), ShouldBeNil)
+		So(sent.Number, ShouldEqual, "+15555550100")
+		So(sent.Status, ShouldEqual, StatusSent)
+
+		var stored Message
+		So(h.db.Where("id = ?", sent.ID).First(&stored).Error, ShouldBeNil)
+		So(stored.Status, ShouldEqual, StatusSent)
+		So(stored.Modem, ShouldEqual, "test")
+
+		Convey("should replay a retry without sending again", func() {
+			retry := h.postMessage(`{"number":"(555) 555-0100","body":"see you at 9"}`, map[string]string{"Idempotency-Key": "appointment-42"})
+			So(retry.Code, ShouldEqual, http.StatusOK)
+			So(retry.Header().Get("Idempotent-Replayed"), ShouldEqual, "true")
+			So(retry.Body.String(), ShouldContainSubstring, sent.ID)
+		})
+
+		Convey("should refuse a different message with the same key", func() {
+			retry := h.postMessage(`{"number":"(555) 555-0100","body":"see you at 10"}`, map[string]string{"Idempotency-Key": "appointment-42"})
+			So(retry.Code, ShouldEqual, http.StatusUnprocessableEntity)
+		})
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+const FormatJSON = "json"
+
+// Route forwards matching inbound messages to a webhook.  Empty conditions
+// match every message.  The json format posts the message, and the kannel
+// format fetches the url with Kannel get-url escapes filled in.
+type Route struct {
+	ID            string    `gorm:"primary_key" json:"id"`
+	Priority      int       `gorm:"index" json:"priority"`
+	NumberPattern string    `gorm:"size:64" json:"number_pattern"`
+	Keyword       string    `gorm:"size:32" json:"keyword"`
+	Modem         string    `gorm:"size:32" json:"modem"`
+	URL           string    `gorm:"size:255" json:"url"`
+	Format        string    `gorm:"size:16" json:"format"`
+	CreatedAt     time.Time `json:"-"`
+	UpdatedAt     time.Time `json:"-"`
+}
+
+func (route *Route) matches(m *Message) bool {
+	if route.NumberPattern != "" {
+		matched, err := regexp.MatchString(route.NumberPattern, m.Number)
+		if err != nil || !matched {
+			return false
+		}
+	}
+
+	if route.Keyword != "" {
+		body := strings.ToUpper(strings.TrimSpace(m.Body))
+		if !strings.HasPrefix(body, strings.ToUpper(route.Keyword)) {
+			return false
+		}
+	}
+
+	if route.Modem != "" && route.Modem != m.Modem {
+		return false
+	}
+
+	return true
+}
+
+// routeMessage returns the route for an inbound message, falling back to the
+// default notification route when no route matches
+func routeMessage(db *gorm.DB, m *Message, fallback *Route) (*Route, error) {
+	var routes []Route
+	if err := db.Order("priority, created_at").Find(&routes).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range routes {
+		if routes[i].matches(m) {
+			return &routes[i], nil
+		}
+	}
+
+	return fallback, nil
+}
+
+func createRoutesHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			routes := []Route{}
+			if err := db.Order("priority, created_at").Find(&routes).Error; err != nil {
+				http.Error(w, "500 Failed to list.", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, routes)
+		case "POST":
+			decoder := json.NewDecoder(r.Body)
+			var route Route
+			err := decoder.Decode(&route)
+			defer r.Body.Close()
+			if err != nil || route.URL == "" {
+				http.Error(w, "400 Bad request.", http.StatusBadRequest)
+				return
+			}
+			if route.Format != "" && route.Format != FormatJSON && route.Format != FormatKannel {
+				http.Error(w, "400 Invalid format.", http.StatusBadRequest)
+				return
+			}
+			if _, err := regexp.Compile(route.NumberPattern); err != nil {
+				http.Error(w, "400 Invalid number pattern.", http.StatusBadRequest)
+				return
+			}
+
+			route.ID = uuid.New().String()
+			if err := db.Create(&route).Error; err != nil {
+				http.Error(w, "500 Failed to create.", http.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(w, http.StatusCreated, route)
+		default:
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+	}
+}
+
+func createRouteHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/routes/")
+
+		var route Route
+		if db.Where("id = ?", id).First(&route).RecordNotFound() {
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			writeJSON(w, http.StatusOK, route)
+		case "DELETE":
+			db.Delete(&route)
+			writeJSON(w, http.StatusOK, route)
+		default:
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRouteMatches(t *testing.T) {
+	Convey("Matching a route", t, func() {
+		m := Message{Number: "+15555550100", Body: " join the list", Modem: "modem1"}
+
+		Convey("should match every message when the route has no conditions", func() {
+			So((&Route{}).matches(&m), ShouldBeTrue)
+		})
+
+		Convey("should match the number against a regular expression", func() {
+			So((&Route{NumberPattern: `^\+1555`}).matches(&m), ShouldBeTrue)
+			So((&Route{NumberPattern: `^\+44`}).matches(&m), ShouldBeFalse)
+		})
+
+		Convey("should match a keyword at the start of the body ignoring case", func() {
+			So((&Route{Keyword: "JOIN"}).matches(&m), ShouldBeTrue)
+			So((&Route{Keyword: "list"}).matches(&m), ShouldBeFalse)
+		})
+
+		Convey("should match the receiving modem", func() {
+			So((&Route{Modem: "modem1"}).matches(&m), ShouldBeTrue)
+			So((&Route{Modem: "modem2"}).matches(&m), ShouldBeFalse)
+		})
+
+		Convey("should require every condition to match", func() {
+			So((&Route{Keyword: "JOIN", Modem: "modem2"}).matches(&m), ShouldBeFalse)
+		})
+	})
+}
+
+func TestRouteMessage(t *testing.T) {
+	Convey("Routing an inbound message", t, func() {
+		db, err := newTestDB()
+		So(err, ShouldBeNil)
+		defer db.Close()
+
+		fallback := &Route{URL: "http://example.com/notification", Format: FormatJSON}
+		m := Message{Number: "+15555550100", Body: "JOIN", Modem: "modem1"}
+
+		Convey("should fall back to the notification route when nothing matches", func() {
+			So(db.Create(&Route{ID: "other", Keyword: "LEAVE", URL: "http://example.com/leave"}).Error, ShouldBeNil)
+
+			route, err := routeMessage(db, &m, fallback)
+			So(err, ShouldBeNil)
+			So(route, ShouldEqual, fallback)
+		})
+
+		Convey("should pick the matching route with the lowest priority first", func() {
+			created := time.Now()
+			So(db.Create(&Route{ID: "late", Priority: 20, URL: "http://example.com/late", CreatedAt: created}).Error, ShouldBeNil)
+			So(db.Create(&Route{ID: "skipped", Priority: 5, Keyword: "LEAVE", URL: "http://example.com/leave", CreatedAt: created}).Error, ShouldBeNil)
+			So(db.Create(&Route{ID: "second", Priority: 10, Keyword: "JOIN", URL: "http://example.com/second", CreatedAt: created.Add(time.Second)}).Error, ShouldBeNil)
+			So(db.Create(&Route{ID: "first", Priority: 10, NumberPattern: `^\+1`, URL: "http://example.com/first", CreatedAt: created}).Error, ShouldBeNil)
+
+			route, err := routeMessage(db, &m, fallback)
+			So(err, ShouldBeNil)
+			So(route.ID, ShouldEqual, "first")
+		})
+	})
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+type Schedule struct {
+	ID        string         `gorm:"primary_key" json:"id"`
+	Cron      string         `gorm:"size:64" json:"cron"`
+	TimeZone  string         `gorm:"size:64" json:"time_zone"`
+	Numbers   pq.StringArray `gorm:"type:text[]" json:"numbers"`
+	Body      string         `gorm:"size:160" json:"body"`
+	Active    bool           `gorm:"index" json:"active"`
+	NextRunAt *time.Time     `gorm:"index" json:"next_run_at"`
+	LastRunAt *time.Time     `json:"last_run_at"`
+	CreatedAt time.Time      `json:"-"`
+	UpdatedAt time.Time      `json:"-"`
+}
+
+func (s *Schedule) location() (*time.Location, error) {
+	if s.TimeZone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(s.TimeZone)
+}
+
+// advance sets NextRunAt to the first occurrence after t.  Local times
+// repeated when clocks fall back only fire at their first instant.
+func (s *Schedule) advance(t time.Time) error {
+	cron, err := parseCron(s.Cron)
+	if err != nil {
+		return err
+	}
+	location, err := s.location()
+	if err != nil {
+		return err
+	}
+
+	next := cron.Next(t.In(location))
+	for !next.IsZero() && next.After(firstInstant(next)) {
+		next = cron.Next(next)
+	}
+	if next.IsZero() {
+		return errors.New("Cron expression never matches")
+	}
+	next = next.UTC()
+	s.NextRunAt = &next
+	return nil
+}
+
+// firstInstant returns the earliest time with the same local wall time as t,
+// which differs from t during the hour repeated when clocks fall back
+func firstInstant(t time.Time) time.Time {
+	first := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, t.Location())
+	for {
+		earlier := first.Add(-time.Hour)
+		if earlier.Format("2006-01-02 15:04") != first.Format("2006-01-02 15:04") {
+			return first
+		}
+		first = earlier
+	}
+}
+
+// runDueSchedules queues a message per number for each schedule whose next
+// occurrence has passed, leaving the sending to the message queue.
+func runDueSchedules(db *gorm.DB) error {
+	now := time.Now().UTC()
+
+	var schedules []Schedule
+	err := db.Where("active = ? AND next_run_at <= ?", true, now).Find(&schedules).Error
+	if err != nil {
+		return err
+	}
+
+	for _, s := range schedules {
+		runAt := s.NextRunAt.UTC()
+
+		tx := db.Begin()
+		messages, err := queueScheduledMessages(tx, &s, runAt, now)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit().Error; err != nil {
+			return err
+		}
+		for i := range messages {
+			publishMessage(&messages[i])
+		}
+	}
+
+	return nil
+}
+
+// queueScheduledMessages creates the messages for one run of s and moves it
+// on to the next occurrence
+func queueScheduledMessages(tx *gorm.DB, s *Schedule, runAt time.Time, now time.Time) ([]Message, error) {
+	messages := []Message{}
+	for _, number := range s.Numbers {
+		m := Message{
+			ID:         uuid.New().String(),
+			Number:     number,
+			Body:       s.Body,
+			Status:     StatusScheduled,
+			SendAt:     &runAt,
+			ScheduleID: s.ID,
+			Time:       now,
+		}
+		if err := tx.Create(&m).Error; err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+
+	// skip occurrences missed while the gateway was down
+	s.LastRunAt = &runAt
+	if err := s.advance(now); err != nil {
+		s.Active = false
+	}
+	return messages, tx.Save(s).Error
+}
+
+func createSchedulesHandler(db *gorm.DB, format *numberFormat) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			schedules := []Schedule{}
+			if err := db.Order("created_at").Find(&schedules).Error; err != nil {
+				http.Error(w, "500 Failed to list.", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, schedules)
+		case "POST":
+			decoder := json.NewDecoder(r.Body)
+			var s Schedule
+			err := decoder.Decode(&s)
+			defer r.Body.Close()
+			if err != nil || len(s.Numbers) == 0 {
+				http.Error(w, "400 Bad request.", http.StatusBadRequest)
+				return
+			}
+			if err := validateBody(s.Body); err != nil {
+				http.Error(w, "400 "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			for i, number := range s.Numbers {
+				s.Numbers[i], err = format.normalize(number)
+				if err != nil {
+					http.Error(w, "400 "+err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+
+			s.ID = uuid.New().String()
+			s.Active = true
+			s.LastRunAt = nil
+			if err := s.advance(time.Now()); err != nil {
+				http.Error(w, "400 "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := db.Create(&s).Error; err != nil {
+				http.Error(w, "500 Failed to create.", http.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(w, http.StatusCreated, s)
+		default:
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+	}
+}
+
+func createScheduleHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/schedules/")
+
+		var s Schedule
+		if db.Where("id = ?", id).First(&s).RecordNotFound() {
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			writeJSON(w, http.StatusOK, s)
+		case "DELETE":
+			// keep the row so sent messages still reference it
+			s.Active = false
+			s.NextRunAt = nil
+			if err := db.Save(&s).Error; err != nil {
+				http.Error(w, "500 Failed to save.", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, s)
+		default:
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+	}
+}
@@ -2,51 +2,187 @@ package main
 
 import (
 	"encoding/json"
-	"log"
+	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/barnybug/gogsmmodem"
-	"github.com/google/uuid"
 	"github.com/jinzhu/gorm"
 )
 
-func createIncomingMessageHandler(db *gorm.DB, modem *gogsmmodem.Modem) http.HandlerFunc {
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	str, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(str)
+}
+
+// writeMessageError responds with the status for an error from submitMessage
+func writeMessageError(w http.ResponseWriter, err error) {
+	if err == errSuppressed {
+		http.Error(w, "403 "+err.Error()+".", http.StatusForbidden)
+	} else if _, ok := err.(invalidMessageError); ok {
+		http.Error(w, "400 "+err.Error(), http.StatusBadRequest)
+	} else {
+		http.Error(w, "500 Failed to send.", http.StatusInternalServerError)
+	}
+}
+
+// messagesQuery lists outbound messages by status, or both sides of a
+// conversation or of everything with a number
+func messagesQuery(db *gorm.DB, number string, conversationID string, campaignID string, status string) *gorm.DB {
+	query := db.Order("created_at")
+	if conversationID != "" {
+		query = query.Where("conversation_id = ?", conversationID)
+	} else if number != "" {
+		query = query.Where("number = ?", number)
+	} else {
+		query = query.Where("incoming = ?", false)
+	}
+	if campaignID != "" {
+		query = query.Where("campaign_id = ?", campaignID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	return query
+}
+
+// conversation summarizes the messages with one number
+type conversation struct {
+	Number      string  `json:"number"`
+	Count       int     `json:"count"`
+	LastMessage Message `json:"last_message"`
+}
+
+// recentConversations lists the numbers with the most recent messages, most
+// recent first, with their message count and last message
+func recentConversations(db *gorm.DB, limit int) ([]conversation, error) {
+	conversations := []conversation{}
+	err := db.Raw("SELECT number, count(*) AS count FROM messages GROUP BY number ORDER BY max(created_at) DESC LIMIT ?", limit).
+		Scan(&conversations).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(conversations) == 0 {
+		return conversations, nil
+	}
+
+	// fetch every conversation's last message together
+	numbers := make([]string, len(conversations))
+	for i := range conversations {
+		numbers[i] = conversations[i].Number
+	}
+	var messages []Message
+	err = db.Select("messages.*").
+		Joins("JOIN (SELECT number, max(created_at) AS last_created_at FROM messages WHERE number IN (?) GROUP BY number) latest "+
+			"ON messages.number = latest.number AND messages.created_at = latest.last_created_at", numbers).
+		Order("messages.id").
+		Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	last := map[string]Message{}
+	for _, m := range messages {
+		if _, ok := last[m.Number]; !ok {
+			last[m.Number] = m
+		}
+	}
+	for i := range conversations {
+		conversations[i].LastMessage = last[conversations[i].Number]
+	}
+	return conversations, nil
+}
+
+func createConversationsHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+
+		conversations, err := recentConversations(db, 100)
+		if err != nil {
+			http.Error(w, "500 Failed to list.", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, conversations)
+	}
+}
+
+func createIncomingMessageHandler(db *gorm.DB, modem *gogsmmodem.Modem, limiter *rateLimiter, format *numberFormat, idempotencyRetention time.Duration) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
+		case "GET":
+			number := r.URL.Query().Get("number")
+			if number != "" {
+				number = format.normalizeSender(number)
+			}
+			query := messagesQuery(db, number, r.URL.Query().Get("conversation_id"), r.URL.Query().Get("campaign_id"), r.URL.Query().Get("status"))
+
+			messages := []Message{}
+			if err := query.Find(&messages).Error; err != nil {
+				http.Error(w, "500 Failed to list.", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, messages)
 		case "POST":
-			// read struct
-			decoder := json.NewDecoder(r.Body)
-			var m Message
-			err := decoder.Decode(&m)
+			// read struct, keeping the body to compare idempotent retries
+			body, err := ioutil.ReadAll(r.Body)
 			defer r.Body.Close()
+			var m Message
+			if err == nil {
+				err = json.Unmarshal(body, &m)
+			}
 			if err != nil {
 				http.Error(w, "400 Bad request.", http.StatusBadRequest)
 				return
 			}
 
-			// save to db
-			m.Incoming = false
-			m.ID = uuid.New().String()
-			m.Time = time.Now().UTC()
-			db.Create(&m)
+			// retries with the same key get the original message back
+			key := r.Header.Get("Idempotency-Key")
+			if len(key) > maxIdempotencyKeyLength {
+				http.Error(w, "400 Idempotency-Key is too long.", http.StatusBadRequest)
+				return
+			}
+			var claim *IdempotencyKey
+			if key != "" {
+				requestHash := hashRequest(body)
+				record, claimed, err := claimIdempotencyKey(db, idempotencyCaller(r), key, requestHash, idempotencyRetention)
+				if err != nil {
+					http.Error(w, "500 Failed to send.", http.StatusInternalServerError)
+					return
+				}
+				if !claimed {
+					replayIdempotentResponse(w, db, record, requestHash)
+					return
+				}
+				claim = record
+			}
 
-			// send
-			log.Printf("Sending message %v: %v\n", m.Number, m.Body)
-			err = modem.SendMessage(m.Number, m.Body)
+			sent, err := submitMessage(db, modem, limiter, format, &m)
+
+			// scheduled and delayed messages are accepted for the queue
+			status := http.StatusOK
 			if err != nil {
-				http.Error(w, "500 Failed to send.", http.StatusInternalServerError)
-				return
+				status = http.StatusInternalServerError
+			} else if !sent {
+				status = http.StatusAccepted
+			}
+			if claim != nil {
+				completeIdempotencyKey(db, claim, &m, status, err)
 			}
 
-			// mark handled and update in db
-			m.Handled = true
-			db.Save(&m)
+			if err != nil {
+				writeMessageError(w, err)
+				return
+			}
 
 			// respond to http request
-			w.WriteHeader(http.StatusOK)
-			str, _ := json.Marshal(m)
-			w.Write([]byte(str))
+			writeJSON(w, status, m)
 		default:
 			http.Error(w, "404 not found.", http.StatusNotFound)
 			return
@@ -54,13 +190,128 @@ func createIncomingMessageHandler(db *gorm.DB, modem *gogsmmodem.Modem) http.Han
 	}
 }
 
-func listenOnHTTP(db *gorm.DB, modem *gogsmmodem.Modem, port string) chan error {
-	errorChannel := make(chan error, 1)
+func createMessageHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/messages/")
+
+		var m Message
+		if db.Where("id = ?", id).First(&m).RecordNotFound() {
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			writeJSON(w, http.StatusOK, m)
+		case "DELETE":
+			// only messages still waiting in the queue can be cancelled.  The
+			// queue can claim the message at any time, so the check is part
+			// of the update
+			result := db.Model(&Message{}).
+				Where("id = ? AND status IN (?)", id, queuedStatuses).
+				Update("status", StatusCancelled)
+			if result.Error != nil {
+				http.Error(w, "500 Failed to cancel.", http.StatusInternalServerError)
+				return
+			}
+			if result.RowsAffected == 0 {
+				http.Error(w, "409 Message is not scheduled.", http.StatusConflict)
+				return
+			}
+
+			m.Status = StatusCancelled
+			publishMessage(&m)
+			writeJSON(w, http.StatusOK, m)
+		default:
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+	}
+}
 
-	http.HandleFunc("/api/messages", createIncomingMessageHandler(db, modem))
+// queueStatus counts outbound messages by status
+func queueStatus(db *gorm.DB) (map[string]int, error) {
+	rows, err := db.Model(&Message{}).
+		Select("status, count(*)").
+		Where("incoming = ?", false).
+		Group("status").
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	for {
-		err := http.ListenAndServe(":"+port, nil)
-		errorChannel <- err
+	counts := map[string]int{}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
 	}
+	return counts, rows.Err()
+}
+
+type gatewayStatus struct {
+	Modem modemStatus    `json:"modem"`
+	Queue map[string]int `json:"queue"`
+}
+
+// createStatusHandler reports the modem status as last seen, signal and
+// storage are checked in the background by listenOnModem
+func createStatusHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+
+		queue, err := queueStatus(db)
+		if err != nil {
+			http.Error(w, "500 Failed to get status.", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, gatewayStatus{Modem: getModemStatus(), Queue: queue})
+	}
+}
+
+func listenOnHTTP(db *gorm.DB, modem *gogsmmodem.Modem, commands *commandPort, limiter *rateLimiter, format *numberFormat, adminToken string, apiKeysRequired bool, idempotencyRetention time.Duration, console *atConsole, recorder *transcriptRecorder, port string) chan error {
+	errorChannel := make(chan error, 1)
+
+	requireKey := func(handler http.HandlerFunc) http.HandlerFunc {
+		return requireAPIKey(db, adminToken, apiKeysRequired, handler)
+	}
+
+	// the page authenticates its api calls with a key entered in the browser
+	http.HandleFunc("/admin", createAdminHandler())
+	http.HandleFunc("/api/status", requireKey(createStatusHandler(db)))
+	http.HandleFunc("/api/messages", requireKey(createIncomingMessageHandler(db, modem, limiter, format, idempotencyRetention)))
+	http.HandleFunc("/api/messages/", requireKey(createMessageHandler(db)))
+	http.HandleFunc("/api/conversations", requireKey(createConversationsHandler(db)))
+	http.HandleFunc("/api/schedules", requireKey(createSchedulesHandler(db, format)))
+	http.HandleFunc("/api/schedules/", requireKey(createScheduleHandler(db)))
+	http.HandleFunc("/api/events", requireKey(createEventsHandler(format)))
+	http.HandleFunc("/api/templates", requireKey(createTemplatesHandler(db)))
+	http.HandleFunc("/api/templates/", requireKey(createTemplateHandler(db)))
+	http.HandleFunc("/api/campaigns", requireKey(createCampaignsHandler(db, format)))
+	http.HandleFunc("/api/campaigns/", requireKey(createCampaignHandler(db)))
+	http.HandleFunc("/api/suppressions", requireAdmin(adminToken, createSuppressionsHandler(db, format)))
+	http.HandleFunc("/api/suppressions/", requireAdmin(adminToken, createSuppressionHandler(db, format)))
+	http.HandleFunc("/api/routes", requireAdmin(adminToken, createRoutesHandler(db)))
+	http.HandleFunc("/api/routes/", requireAdmin(adminToken, createRouteHandler(db)))
+	http.HandleFunc("/api/autoresponses", requireAdmin(adminToken, createAutoResponsesHandler(db)))
+	http.HandleFunc("/api/autoresponses/", requireAdmin(adminToken, createAutoResponseHandler(db)))
+	http.HandleFunc("/api/modem/at", requireAdmin(adminToken, createATConsoleHandler(db, commands, console)))
+	http.HandleFunc("/api/modem/transcript", requireAdmin(adminToken, createTranscriptHandler(recorder)))
+
+	go func() {
+		for {
+			err := http.ListenAndServe(":"+port, nil)
+			errorChannel <- err
+			time.Sleep(1 * time.Second)
+		}
+	}()
+
+	return errorChannel
 }
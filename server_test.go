@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newTestDB opens an in-memory database with the gateway's tables
+func newTestDB() (*gorm.DB, error) {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// each connection would get its own in-memory database
+	db.DB().SetMaxOpenConns(1)
+	err = db.AutoMigrate(&Message{}, &Schedule{}, &Suppression{}, &Route{}, &AutoResponse{}, &Campaign{}, &Template{}, &APIKey{}, &IdempotencyKey{}, &ATCommand{}).Error
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// failInserts makes inserts into table fail as a database error would
+func failInserts(db *gorm.DB, table string) {
+	db.Callback().Create().Before("gorm:create").Register("test:fail_inserts", func(scope *gorm.Scope) {
+		if scope.TableName() == table {
+			scope.Err(errors.New("Insert failed"))
+		}
+	})
+}
+
+func TestCancelMessage(t *testing.T) {
+	Convey("Cancelling a message", t, func() {
+		db, err := newTestDB()
+		So(err, ShouldBeNil)
+		defer db.Close()
+
+		So(db.Create(&Message{ID: "scheduled", Number: "+15555550100", Status: StatusScheduled}).Error, ShouldBeNil)
+		So(db.Create(&Message{ID: "sending", Number: "+15555550100", Status: StatusSending}).Error, ShouldBeNil)
+		handler := createMessageHandler(db)
+
+		Convey("should cancel a scheduled message", func() {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("DELETE", "/api/messages/scheduled", nil))
+			So(w.Code, ShouldEqual, http.StatusOK)
+
+			var m Message
+			So(db.Where("id = ?", "scheduled").First(&m).Error, ShouldBeNil)
+			So(m.Status, ShouldEqual, StatusCancelled)
+		})
+
+		Convey("should refuse a message the queue has claimed", func() {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("DELETE", "/api/messages/sending", nil))
+			So(w.Code, ShouldEqual, http.StatusConflict)
+
+			var m Message
+			So(db.Where("id = ?", "sending").First(&m).Error, ShouldBeNil)
+			So(m.Status, ShouldEqual, StatusSending)
+		})
+	})
+}
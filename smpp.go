@@ -0,0 +1,550 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/jinzhu/gorm"
+)
+
+// A minimal SMPP 3.4 SMSC accepting submit_sm into the outbound queue and
+// delivering inbound messages and delivery receipts as deliver_sm
+
+const (
+	smppGenericNack      = 0x80000000
+	smppBindReceiver     = 0x00000001
+	smppBindTransmitter  = 0x00000002
+	smppSubmitSM         = 0x00000004
+	smppDeliverSM        = 0x00000005
+	smppUnbind           = 0x00000006
+	smppBindTransceiver  = 0x00000009
+	smppEnquireLink      = 0x00000015
+	smppResponse         = 0x80000000
+	smppMaxPDULength     = 64 * 1024
+	smppTagPayload       = 0x0424
+	smppTagReceiptID     = 0x001e
+	smppTagMessageState  = 0x0427
+	smppStatusOK         = 0x00000000
+	smppStatusInvMsgLen  = 0x00000001
+	smppStatusInvCmdID   = 0x00000003
+	smppStatusInvBndSts  = 0x00000004
+	smppStatusSysErr     = 0x00000008
+	smppStatusInvDstAdr  = 0x0000000b
+	smppStatusInvPaswd   = 0x0000000e
+	smppStatusSubmitFail = 0x00000045
+)
+
+type smppPDU struct {
+	CommandID uint32
+	Status    uint32
+	Sequence  uint32
+	Body      []byte
+}
+
+func readSMPPPDU(r io.Reader) (*smppPDU, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header)
+	if length < 16 || length > smppMaxPDULength {
+		return nil, fmt.Errorf("Invalid SMPP command length %v", length)
+	}
+
+	body := make([]byte, length-16)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	return &smppPDU{
+		CommandID: binary.BigEndian.Uint32(header[4:]),
+		Status:    binary.BigEndian.Uint32(header[8:]),
+		Sequence:  binary.BigEndian.Uint32(header[12:]),
+		Body:      body,
+	}, nil
+}
+
+func (p *smppPDU) encode() []byte {
+	packet := make([]byte, 16, 16+len(p.Body))
+	binary.BigEndian.PutUint32(packet, uint32(16+len(p.Body)))
+	binary.BigEndian.PutUint32(packet[4:], p.CommandID)
+	binary.BigEndian.PutUint32(packet[8:], p.Status)
+	binary.BigEndian.PutUint32(packet[12:], p.Sequence)
+	return append(packet, p.Body...)
+}
+
+// smppReader reads the fields of a pdu body in order
+type smppReader struct {
+	body []byte
+	err  error
+}
+
+func (r *smppReader) cstring() string {
+	if r.err != nil {
+		return ""
+	}
+	i := bytes.IndexByte(r.body, 0)
+	if i < 0 {
+		r.err = errors.New("Unterminated SMPP string")
+		return ""
+	}
+	s := string(r.body[:i])
+	r.body = r.body[i+1:]
+	return s
+}
+
+func (r *smppReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.body) < 1 {
+		r.err = errors.New("Truncated SMPP pdu")
+		return 0
+	}
+	b := r.body[0]
+	r.body = r.body[1:]
+	return b
+}
+
+func (r *smppReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.body) < n {
+		r.err = errors.New("Truncated SMPP pdu")
+		return nil
+	}
+	b := r.body[:n]
+	r.body = r.body[n:]
+	return b
+}
+
+// tlvs reads the optional parameters remaining in the body
+func (r *smppReader) tlvs() map[uint16][]byte {
+	tlvs := map[uint16][]byte{}
+	for r.err == nil && len(r.body) >= 4 {
+		tag := binary.BigEndian.Uint16(r.body)
+		length := int(binary.BigEndian.Uint16(r.body[2:]))
+		r.body = r.body[4:]
+		tlvs[tag] = r.bytes(length)
+	}
+	return tlvs
+}
+
+func appendCString(b []byte, s string) []byte {
+	return append(append(b, s...), 0)
+}
+
+func appendTLV(b []byte, tag uint16, value []byte) []byte {
+	b = append(b, byte(tag>>8), byte(tag), byte(len(value)>>8), byte(len(value)))
+	return append(b, value...)
+}
+
+type smppSubmit struct {
+	Source             string
+	Destination        string
+	RegisteredDelivery byte
+	Text               string
+}
+
+func decodeSMPPText(dataCoding byte, message []byte) (string, error) {
+	switch dataCoding {
+	case 0, 1, 3:
+		// default alphabet, ascii and latin 1 are taken byte for byte
+		runes := make([]rune, len(message))
+		for i, b := range message {
+			runes[i] = rune(b)
+		}
+		return string(runes), nil
+	case 8:
+		if len(message)%2 != 0 {
+			return "", errors.New("Odd length UCS2 message")
+		}
+		units := make([]uint16, len(message)/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(message[i*2:])
+		}
+		return string(utf16.Decode(units)), nil
+	}
+	return "", fmt.Errorf("Unsupported data coding %v", dataCoding)
+}
+
+func decodeSMPPSubmit(body []byte) (*smppSubmit, error) {
+	r := &smppReader{body: body}
+	r.cstring() // service_type
+	r.byte()    // source_addr_ton
+	r.byte()    // source_addr_npi
+	source := r.cstring()
+	r.byte() // dest_addr_ton
+	r.byte() // dest_addr_npi
+	destination := r.cstring()
+	r.byte()    // esm_class
+	r.byte()    // protocol_id
+	r.byte()    // priority_flag
+	r.cstring() // schedule_delivery_time
+	r.cstring() // validity_period
+	registeredDelivery := r.byte()
+	r.byte() // replace_if_present_flag
+	dataCoding := r.byte()
+	r.byte() // sm_default_msg_id
+	length := r.byte()
+	message := r.bytes(int(length))
+
+	// long messages may be sent in the payload instead
+	if payload, ok := r.tlvs()[smppTagPayload]; ok && length == 0 {
+		message = payload
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	text, err := decodeSMPPText(dataCoding, message)
+	if err != nil {
+		return nil, err
+	}
+
+	return &smppSubmit{
+		Source:             source,
+		Destination:        destination,
+		RegisteredDelivery: registeredDelivery,
+		Text:               text,
+	}, nil
+}
+
+// encodeSMPPText picks the narrowest data coding for text: the default
+// alphabet for ascii, latin 1 when it fits, and UCS2 otherwise
+func encodeSMPPText(text string) (byte, []byte) {
+	var dataCoding byte
+	for _, c := range text {
+		if c > 0xff {
+			dataCoding = 8
+			break
+		}
+		if c > 0x7f {
+			dataCoding = 3
+		}
+	}
+
+	switch dataCoding {
+	case 3:
+		message := make([]byte, 0, len(text))
+		for _, c := range text {
+			message = append(message, byte(c))
+		}
+		return dataCoding, message
+	case 8:
+		units := utf16.Encode([]rune(text))
+		message := make([]byte, len(units)*2)
+		for i, unit := range units {
+			binary.BigEndian.PutUint16(message[i*2:], unit)
+		}
+		return dataCoding, message
+	}
+	return dataCoding, []byte(text)
+}
+
+// encodeSMPPDeliver builds a deliver_sm body, a delivery receipt when
+// receiptID is set
+func encodeSMPPDeliver(source, destination, text string, receiptID string, messageState byte) []byte {
+	var esmClass byte
+	if receiptID != "" {
+		esmClass = 0x04
+	}
+
+	dataCoding, short := encodeSMPPText(text)
+	body := appendCString(nil, "") // service_type
+	body = append(body, 1, 1)      // international, isdn
+	body = appendCString(body, source)
+	body = append(body, 1, 1)
+	body = appendCString(body, destination)
+	body = append(body, esmClass, 0, 0)
+	body = appendCString(body, "") // schedule_delivery_time
+	body = appendCString(body, "") // validity_period
+	body = append(body, 0, 0, dataCoding, 0)
+	if len(short) > 254 {
+		body = append(body, 0)
+		body = appendTLV(body, smppTagPayload, short)
+	} else {
+		body = append(body, byte(len(short)))
+		body = append(body, short...)
+	}
+
+	if receiptID != "" {
+		body = appendTLV(body, smppTagReceiptID, appendCString(nil, receiptID))
+		body = appendTLV(body, smppTagMessageState, []byte{messageState})
+	}
+	return body
+}
+
+// smppReceiptState maps a final message status to the receipt stat and
+// message_state, or returns false while the message is still in progress
+func smppReceiptState(status string) (string, byte, bool) {
+	switch status {
+	case StatusSent:
+		return "DELIVRD", 2, true
+	case StatusCancelled:
+		return "DELETED", 4, true
+	case StatusFailed:
+		return "UNDELIV", 5, true
+	case StatusSuppressed:
+		return "REJECTD", 8, true
+	}
+	return "", 0, false
+}
+
+func smppReceiptText(m *Message, stat string) string {
+	text := m.Body
+	if runes := []rune(text); len(runes) > 20 {
+		text = string(runes[:20])
+	}
+	delivered := "000"
+	if stat == "DELIVRD" {
+		delivered = "001"
+	}
+	return fmt.Sprintf("id:%v sub:001 dlvrd:%v submit date:%v done date:%v stat:%v err:000 text:%v",
+		m.ID, delivered, m.CreatedAt.Format("0601021504"), m.Time.Format("0601021504"), stat, text)
+}
+
+type smppServer struct {
+	db       *gorm.DB
+	format   *numberFormat
+	systemID string
+	password string
+	modem    string
+
+	mutex sync.Mutex
+	// inbound messages are delivered from the last event sent to a receiver
+	lastDeliveredID int64
+	// messages waiting for a receipt, by submit time
+	receipts map[string]time.Time
+}
+
+// receipts are forgotten after a day without a receiver to deliver them
+const smppReceiptExpiry = 24 * time.Hour
+
+// expectReceipt notes that m's submitter wants a receipt, forgetting expired
+// ones.  Callers hold the mutex.
+func (s *smppServer) expectReceipt(id string, now time.Time) {
+	for receiptID, submitted := range s.receipts {
+		if now.Sub(submitted) > smppReceiptExpiry {
+			delete(s.receipts, receiptID)
+		}
+	}
+	s.receipts[id] = now
+}
+
+type smppSession struct {
+	server   *smppServer
+	conn     net.Conn
+	mutex    sync.Mutex
+	sequence uint32
+	bound    uint32
+	done     chan struct{}
+}
+
+func (s *smppSession) write(p *smppPDU) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := s.conn.Write(p.encode())
+	return err
+}
+
+func (s *smppSession) respond(req *smppPDU, status uint32, body []byte) error {
+	return s.write(&smppPDU{CommandID: req.CommandID | smppResponse, Status: status, Sequence: req.Sequence, Body: body})
+}
+
+func (s *smppSession) nextSequence() uint32 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sequence++
+	return s.sequence
+}
+
+func (s *smppSession) bind(req *smppPDU) error {
+	r := &smppReader{body: req.Body}
+	systemID := r.cstring()
+	password := r.cstring()
+	if r.err != nil {
+		return s.respond(req, smppStatusInvMsgLen, nil)
+	}
+	if s.bound != 0 {
+		return s.respond(req, smppStatusInvBndSts, nil)
+	}
+
+	idMatch := subtle.ConstantTimeCompare([]byte(systemID), []byte(s.server.systemID)) == 1
+	passwordMatch := subtle.ConstantTimeCompare([]byte(password), []byte(s.server.password)) == 1
+	if !idMatch || !passwordMatch {
+		log.Printf("Refused SMPP bind from %v as %v\n", s.conn.RemoteAddr(), systemID)
+		return s.respond(req, smppStatusInvPaswd, nil)
+	}
+
+	log.Printf("SMPP bind from %v as %v\n", s.conn.RemoteAddr(), systemID)
+	s.bound = req.CommandID
+	if err := s.respond(req, smppStatusOK, appendCString(nil, s.server.systemID)); err != nil {
+		return err
+	}
+
+	if req.CommandID != smppBindTransmitter {
+		go s.deliver()
+	}
+	return nil
+}
+
+func (s *smppSession) submit(req *smppPDU) error {
+	if s.bound != smppBindTransmitter && s.bound != smppBindTransceiver {
+		return s.respond(req, smppStatusInvBndSts, nil)
+	}
+
+	submit, err := decodeSMPPSubmit(req.Body)
+	if err != nil {
+		return s.respond(req, smppStatusInvMsgLen, nil)
+	}
+
+	m := Message{Number: submit.Destination, Body: submit.Text}
+	err = enqueueMessage(s.server.db, s.server.format, &m)
+	if err != nil {
+		log.Printf("Rejected SMPP submit to %v: %v\n", submit.Destination, err)
+		if err == errSuppressed {
+			return s.respond(req, smppStatusInvDstAdr, nil)
+		} else if _, ok := err.(invalidMessageError); ok {
+			return s.respond(req, smppStatusSubmitFail, nil)
+		}
+		return s.respond(req, smppStatusSysErr, nil)
+	}
+
+	if submit.RegisteredDelivery&0x03 != 0 {
+		s.server.mutex.Lock()
+		s.server.expectReceipt(m.ID, time.Now())
+		s.server.mutex.Unlock()
+	}
+	return s.respond(req, smppStatusOK, appendCString(nil, m.ID))
+}
+
+// deliver sends inbound messages and receipts to a bound receiver
+func (s *smppSession) deliver() {
+	s.server.mutex.Lock()
+	lastID := s.server.lastDeliveredID
+	s.server.mutex.Unlock()
+
+	events.follow(lastID, eventTypes(EventInbound, EventStatus), s.done, func(e Event) error {
+		m, ok := e.Data.(Message)
+		if !ok {
+			return nil
+		}
+
+		var body []byte
+		if e.Type == EventInbound {
+			body = encodeSMPPDeliver(m.Number, s.server.modem, m.Body, "", 0)
+
+			s.server.mutex.Lock()
+			if e.ID > s.server.lastDeliveredID {
+				s.server.lastDeliveredID = e.ID
+			}
+			s.server.mutex.Unlock()
+		} else {
+			stat, state, final := smppReceiptState(m.Status)
+			s.server.mutex.Lock()
+			_, wanted := s.server.receipts[m.ID]
+			if final {
+				delete(s.server.receipts, m.ID)
+			}
+			s.server.mutex.Unlock()
+			if !final || !wanted {
+				return nil
+			}
+			body = encodeSMPPDeliver(m.Number, s.server.modem, smppReceiptText(&m, stat), m.ID, state)
+		}
+
+		return s.write(&smppPDU{CommandID: smppDeliverSM, Sequence: s.nextSequence(), Body: body})
+	})
+}
+
+func (s *smppSession) serve() {
+	defer s.conn.Close()
+	defer close(s.done)
+
+	reader := bufio.NewReader(s.conn)
+	for {
+		req, err := readSMPPPDU(reader)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("SMPP connection from %v: %v\n", s.conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		switch req.CommandID {
+		case smppBindReceiver, smppBindTransmitter, smppBindTransceiver:
+			err = s.bind(req)
+		case smppSubmitSM:
+			err = s.submit(req)
+		case smppEnquireLink:
+			err = s.respond(req, smppStatusOK, nil)
+		case smppUnbind:
+			s.respond(req, smppStatusOK, nil)
+			return
+		case smppDeliverSM | smppResponse, smppEnquireLink | smppResponse, smppGenericNack:
+			// responses to our deliveries need no handling
+		default:
+			err = s.write(&smppPDU{CommandID: smppGenericNack, Status: smppStatusInvCmdID, Sequence: req.Sequence})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func listenOnSMPP(db *gorm.DB, format *numberFormat, port string, systemID string, password string, modemName string) chan error {
+	errorChannel := make(chan error, 1)
+
+	// anyone who can reach the port could send through the SIM
+	if password == "" {
+		errorChannel <- errors.New("Not accepting SMPP binds without SMPP_PASSWORD")
+		return errorChannel
+	}
+
+	server := &smppServer{
+		db:       db,
+		format:   format,
+		systemID: systemID,
+		password: password,
+		modem:    modemName,
+		receipts: map[string]time.Time{},
+	}
+
+	go func() {
+		for {
+			listener, err := net.Listen("tcp", ":"+port)
+			if err != nil {
+				errorChannel <- err
+				time.Sleep(5 * time.Second)
+				continue
+			}
+
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					errorChannel <- err
+					break
+				}
+				session := &smppSession{server: server, conn: conn, done: make(chan struct{})}
+				go session.serve()
+			}
+			listener.Close()
+		}
+	}()
+
+	return errorChannel
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSMPP(t *testing.T) {
+	Convey("Decoding submit_sm", t, func() {
+		body := appendCString(nil, "")
+		body = append(body, 1, 1)
+		body = appendCString(body, "gateway")
+		body = append(body, 1, 1)
+		body = appendCString(body, "15555555555")
+		body = append(body, 0, 0, 0)
+		body = appendCString(body, "")
+		body = appendCString(body, "")
+		body = append(body, 1, 0, 8, 0, 4, 0x00, 'h', 0x00, 'i')
+
+		submit, err := decodeSMPPSubmit(body)
+		So(err, ShouldBeNil)
+		So(submit.Destination, ShouldEqual, "15555555555")
+		So(submit.RegisteredDelivery, ShouldEqual, 1)
+		So(submit.Text, ShouldEqual, "hi")
+
+		Convey("should decode UCS2 text outside ascii", func() {
+			body = append(body[:len(body)-5], 6, 0x00, 0xe9, 0x20, 0xac, 0x04, 0x1f)
+			submit, err := decodeSMPPSubmit(body)
+			So(err, ShouldBeNil)
+			So(submit.Text, ShouldEqual, "é€П")
+		})
+	})
+
+	Convey("Encoding deliver_sm text", t, func() {
+		Convey("should use the default alphabet for ascii", func() {
+			dataCoding, message := encodeSMPPText("hi")
+			So(dataCoding, ShouldEqual, 0)
+			So(string(message), ShouldEqual, "hi")
+		})
+
+		Convey("should use latin 1 when it fits", func() {
+			dataCoding, message := encodeSMPPText("café")
+			So(dataCoding, ShouldEqual, 3)
+			So(message, ShouldResemble, []byte{'c', 'a', 'f', 0xe9})
+		})
+
+		Convey("should use UCS2 otherwise", func() {
+			dataCoding, message := encodeSMPPText("€5")
+			So(dataCoding, ShouldEqual, 8)
+			So(message, ShouldResemble, []byte{0x20, 0xac, 0x00, '5'})
+		})
+
+		Convey("should read back as sent", func() {
+			for _, text := range []string{"café", "Привет €"} {
+				submit, err := decodeSMPPSubmit(encodeSMPPDeliver("+15555555555", "gateway", text, "", 0))
+				So(err, ShouldBeNil)
+				So(submit.Text, ShouldEqual, text)
+			}
+		})
+	})
+
+	Convey("Binding", t, func() {
+		client, conn := net.Pipe()
+		defer client.Close()
+		server := &smppServer{systemID: "gateway", password: "secret", receipts: map[string]time.Time{}}
+		session := &smppSession{server: server, conn: conn, done: make(chan struct{})}
+		go session.serve()
+
+		bind := func(password string) *smppPDU {
+			body := appendCString(nil, "gateway")
+			body = appendCString(body, password)
+			body = appendCString(body, "")
+			body = append(body, 0x34, 0, 0, 0)
+			client.Write((&smppPDU{CommandID: smppBindTransmitter, Sequence: 1, Body: body}).encode())
+			resp, _ := readSMPPPDU(client)
+			return resp
+		}
+
+		Convey("should refuse the wrong password", func() {
+			resp := bind("wrong")
+			So(resp.CommandID, ShouldEqual, smppBindTransmitter|smppResponse)
+			So(resp.Status, ShouldEqual, smppStatusInvPaswd)
+		})
+
+		Convey("should accept the right password", func() {
+			resp := bind("secret")
+			So(resp.Status, ShouldEqual, smppStatusOK)
+			So(resp.Sequence, ShouldEqual, 1)
+		})
+	})
+
+	Convey("Starting without a password", t, func() {
+		err := <-listenOnSMPP(nil, nil, "0", "gateway", "", "test")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Tracking receipts", t, func() {
+		server := &smppServer{receipts: map[string]time.Time{}}
+		now := time.Now()
+		server.expectReceipt("old", now.Add(-25*time.Hour))
+		server.expectReceipt("new", now)
+
+		Convey("should forget receipts nobody collected", func() {
+			So(server.receipts, ShouldContainKey, "new")
+			So(server.receipts, ShouldNotContainKey, "old")
+		})
+	})
+
+	Convey("Writing receipt text", t, func() {
+		m := Message{ID: "id", Body: "ça va? à bientôt, très bien"}
+
+		Convey("should not split characters", func() {
+			text := smppReceiptText(&m, "DELIVRD")
+			So(text, ShouldEndWith, "text:ça va? à bientôt, tr")
+		})
+	})
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// An smstools3 style spool directory interface.  Files dropped in outgoing
+// are moved to checked while queued, then to sent or failed with status
+// headers added, and inbound messages are written to incoming.
+
+const spoolTimeFormat = "06-01-02 15:04:05"
+
+type spoolConfig struct {
+	outgoing string
+	checked  string
+	sent     string
+	failed   string
+	incoming string
+}
+
+type spoolFile struct {
+	Headers map[string]string
+	Body    string
+}
+
+func parseSpoolFile(data []byte) (*spoolFile, error) {
+	f := &spoolFile{Headers: map[string]string{}}
+
+	// headers end at the first blank line
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid header line %q", line)
+		}
+		f.Headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		if err != nil {
+			break
+		}
+	}
+
+	body, _ := ioutil.ReadAll(reader)
+	f.Body = strings.TrimRight(string(body), "\r\n")
+	return f, nil
+}
+
+// spoolFileName returns the name a file was dropped in outgoing with, without
+// the unique suffix added in checked
+func spoolFileName(checked string) string {
+	name := filepath.Base(checked)
+	if i := strings.LastIndex(name, "."); i > 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// moveSpoolFile writes data with extra headers to dir as name and removes the
+// original
+func moveSpoolFile(path string, dir string, name string, headers []string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	for _, header := range headers {
+		out.WriteString(header + "\n")
+	}
+	out.Write(data)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, name), out.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func failSpoolFile(config *spoolConfig, path string, name string, reason string) error {
+	log.Printf("Failed spool file %v: %v\n", name, reason)
+	return moveSpoolFile(path, config.failed, name, []string{
+		"Failed: " + time.Now().Format(spoolTimeFormat),
+		"Fail_reason: " + reason,
+	})
+}
+
+// checkOutgoing queues each file in the outgoing directory
+func checkOutgoing(db *gorm.DB, format *numberFormat, config *spoolConfig) error {
+	files, err := ioutil.ReadDir(config.outgoing)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range files {
+		// skip directories and files still being written, smstools3 style
+		name := info.Name()
+		if info.IsDir() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".LOCK") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(config.outgoing, name+".LOCK")); err == nil {
+			continue
+		}
+
+		path := filepath.Join(config.outgoing, name)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		f, err := parseSpoolFile(data)
+		if err != nil {
+			if err := failSpoolFile(config, path, name, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// a file with the same name may already be queued, so give each its
+		// own name in checked
+		temp, err := ioutil.TempFile(config.checked, name+".")
+		if err != nil {
+			return err
+		}
+		temp.Close()
+		checked := temp.Name()
+		if err := os.Rename(path, checked); err != nil {
+			os.Remove(checked)
+			return err
+		}
+
+		// smstools3 numbers are international, without the +
+		number := f.Headers["To"]
+		if !strings.HasPrefix(number, "+") {
+			number = "+" + number
+		}
+
+		m := Message{Number: number, Body: f.Body, SpoolFile: filepath.Base(checked)}
+		err = enqueueMessage(db, format, &m)
+		if _, ok := err.(invalidMessageError); ok || err == errSuppressed {
+			if err := failSpoolFile(config, checked, name, err.Error()); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			// put the file back to try again once the database recovers
+			if renameErr := os.Rename(checked, path); renameErr != nil {
+				return renameErr
+			}
+			return err
+		}
+		log.Printf("Queued spool file %v as %v\n", filepath.Base(checked), m.ID)
+	}
+
+	return nil
+}
+
+// finishSpoolFile moves a file to sent or failed once its message is done
+func finishSpoolFile(config *spoolConfig, m *Message) error {
+	checked := filepath.Join(config.checked, m.SpoolFile)
+	if _, err := os.Stat(checked); err != nil {
+		// already moved
+		return nil
+	}
+
+	name := spoolFileName(checked)
+	switch m.Status {
+	case StatusSent:
+		return moveSpoolFile(checked, config.sent, name, []string{
+			"Sent: " + m.Time.Local().Format(spoolTimeFormat),
+			"Message_id: " + m.ID,
+			"Modem: " + m.Modem,
+		})
+	case StatusFailed, StatusSuppressed, StatusCancelled:
+		return failSpoolFile(config, checked, name, m.Status)
+	}
+	return nil
+}
+
+func writeIncoming(config *spoolConfig, m *Message) error {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "From: %v\n", strings.TrimPrefix(m.Number, "+"))
+	fmt.Fprintf(&out, "Sent: %v\n", m.Time.Local().Format(spoolTimeFormat))
+	fmt.Fprintf(&out, "Received: %v\n", time.Now().Format(spoolTimeFormat))
+	fmt.Fprintf(&out, "Modem: %v\n", m.Modem)
+	fmt.Fprintf(&out, "Length: %v\n", len([]rune(m.Body)))
+	fmt.Fprintf(&out, "\n%v\n", m.Body)
+
+	// write then rename so readers never see a partial file
+	name := filepath.Base(m.Modem) + "." + m.ID
+	temp := filepath.Join(config.incoming, "."+name)
+	if err := ioutil.WriteFile(temp, out.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, filepath.Join(config.incoming, name))
+}
+
+func listenOnSpool(db *gorm.DB, format *numberFormat, config *spoolConfig) chan error {
+	errorChannel := make(chan error, 1)
+
+	if config.outgoing != "" {
+		for _, dir := range []string{config.checked, config.sent, config.failed} {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				errorChannel <- err
+				return errorChannel
+			}
+		}
+
+		go func() {
+			for {
+				if err := checkOutgoing(db, format, config); err != nil {
+					errorChannel <- err
+				}
+				time.Sleep(1 * time.Second)
+			}
+		}()
+	}
+
+	go events.follow(0, eventTypes(EventStatus, EventInbound), nil, func(e Event) error {
+		m, ok := e.Data.(Message)
+		if !ok {
+			return nil
+		}
+
+		var err error
+		if e.Type == EventStatus && m.SpoolFile != "" && config.outgoing != "" {
+			err = finishSpoolFile(config, &m)
+		} else if e.Type == EventInbound && config.incoming != "" {
+			err = writeIncoming(config, &m)
+		}
+		if err != nil {
+			errorChannel <- err
+		}
+		return nil
+	})
+
+	return errorChannel
+}
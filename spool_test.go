@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSpool(t *testing.T) {
+	Convey("Parsing spool files", t, func() {
+		f, err := parseSpoolFile([]byte("To: 15555555555\nFlash: no\n\nhello\nthere\n"))
+		So(err, ShouldBeNil)
+		So(f.Headers["To"], ShouldEqual, "15555555555")
+		So(f.Headers["Flash"], ShouldEqual, "no")
+		So(f.Body, ShouldEqual, "hello\nthere")
+	})
+
+	Convey("Checking the outgoing directory", t, func() {
+		root, _ := ioutil.TempDir("", "spool")
+		defer os.RemoveAll(root)
+		config := &spoolConfig{
+			outgoing: filepath.Join(root, "outgoing"),
+			checked:  filepath.Join(root, "checked"),
+			sent:     filepath.Join(root, "sent"),
+			failed:   filepath.Join(root, "failed"),
+		}
+		for _, dir := range []string{config.outgoing, config.checked, config.sent, config.failed} {
+			os.MkdirAll(dir, 0755)
+		}
+		format := newNumberFormat("1", "1", "011")
+
+		Convey("should move files with invalid numbers to failed with a reason", func() {
+			ioutil.WriteFile(filepath.Join(config.outgoing, "test"), []byte("To: 555\n\nhello\n"), 0644)
+
+			So(checkOutgoing(nil, format, config), ShouldBeNil)
+			data, err := ioutil.ReadFile(filepath.Join(config.failed, "test"))
+			So(err, ShouldBeNil)
+			So(string(data), ShouldContainSubstring, "Fail_reason: Invalid phone number")
+			So(strings.HasSuffix(string(data), "To: 555\n\nhello\n"), ShouldBeTrue)
+		})
+
+		Convey("should queue numbers as international", func() {
+			db, err := newTestDB()
+			So(err, ShouldBeNil)
+			defer db.Close()
+			ioutil.WriteFile(filepath.Join(config.outgoing, "test"), []byte("To: 447700900123\n\nhello\n"), 0644)
+
+			So(checkOutgoing(db, format, config), ShouldBeNil)
+			var m Message
+			So(db.First(&m).Error, ShouldBeNil)
+			So(m.Number, ShouldEqual, "+447700900123")
+			_, err = os.Stat(filepath.Join(config.checked, m.SpoolFile))
+			So(err, ShouldBeNil)
+		})
+
+		Convey("should leave files in outgoing when the database fails", func() {
+			db, err := newTestDB()
+			So(err, ShouldBeNil)
+			db.Close()
+			ioutil.WriteFile(filepath.Join(config.outgoing, "test"), []byte("To: 15555555555\n\nhello\n"), 0644)
+
+			So(checkOutgoing(db, format, config), ShouldNotBeNil)
+			_, err = os.Stat(filepath.Join(config.outgoing, "test"))
+			So(err, ShouldBeNil)
+			checked, _ := ioutil.ReadDir(config.checked)
+			So(checked, ShouldBeEmpty)
+			failed, _ := ioutil.ReadDir(config.failed)
+			So(failed, ShouldBeEmpty)
+		})
+
+		Convey("should move sent files to sent under their original name", func() {
+			db, err := newTestDB()
+			So(err, ShouldBeNil)
+			defer db.Close()
+			ioutil.WriteFile(filepath.Join(config.outgoing, "test.txt"), []byte("To: 15555555555\n\nhello\n"), 0644)
+			So(checkOutgoing(db, format, config), ShouldBeNil)
+
+			var m Message
+			So(db.First(&m).Error, ShouldBeNil)
+			m.Status = StatusSent
+			So(finishSpoolFile(config, &m), ShouldBeNil)
+			data, err := ioutil.ReadFile(filepath.Join(config.sent, "test.txt"))
+			So(err, ShouldBeNil)
+			So(string(data), ShouldContainSubstring, "Message_id: "+m.ID)
+		})
+
+		Convey("should keep files with the same name apart", func() {
+			db, err := newTestDB()
+			So(err, ShouldBeNil)
+			defer db.Close()
+			ioutil.WriteFile(filepath.Join(config.outgoing, "test"), []byte("To: 15555555555\n\nfirst\n"), 0644)
+			So(checkOutgoing(db, format, config), ShouldBeNil)
+			ioutil.WriteFile(filepath.Join(config.outgoing, "test"), []byte("To: 15555555555\n\nsecond\n"), 0644)
+			So(checkOutgoing(db, format, config), ShouldBeNil)
+
+			var messages []Message
+			So(db.Order("body").Find(&messages).Error, ShouldBeNil)
+			So(messages, ShouldHaveLength, 2)
+			So(messages[0].SpoolFile, ShouldNotEqual, messages[1].SpoolFile)
+			for _, m := range messages {
+				data, err := ioutil.ReadFile(filepath.Join(config.checked, m.SpoolFile))
+				So(err, ShouldBeNil)
+				So(string(data), ShouldContainSubstring, m.Body)
+			}
+		})
+
+		Convey("should leave locked files alone", func() {
+			ioutil.WriteFile(filepath.Join(config.outgoing, "test"), []byte("To: 555\n\nhello\n"), 0644)
+			ioutil.WriteFile(filepath.Join(config.outgoing, "test.LOCK"), []byte{}, 0644)
+
+			So(checkOutgoing(nil, format, config), ShouldBeNil)
+			_, err := os.Stat(filepath.Join(config.outgoing, "test"))
+			So(err, ShouldBeNil)
+		})
+	})
+}
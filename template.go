@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// maxTemplateLength is the size of the template body column
+const maxTemplateLength = 255
+
+type Template struct {
+	ID        string    `gorm:"primary_key" json:"id"`
+	Name      string    `gorm:"size:64;unique_index" json:"name"`
+	Body      string    `gorm:"size:255" json:"body"`
+	Language  string    `gorm:"size:16" json:"language"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+// renderPlaceholders replaces {{name}} placeholders in body with variables,
+// failing if any are missing
+func renderPlaceholders(body string, variables map[string]string) (string, error) {
+	missing := []string{}
+	rendered := placeholderPattern.ReplaceAllStringFunc(body, func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		value, ok := variables[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("Missing variables: %v", strings.Join(missing, ", "))
+	}
+	return rendered, nil
+}
+
+// validateTemplateBody checks a template fits its column and that the text
+// around its placeholders could be sent, so renderings aren't bound to fail
+func validateTemplateBody(body string) error {
+	if body == "" {
+		return fmt.Errorf("Missing body")
+	}
+	if length := utf8.RuneCountInString(body); length > maxTemplateLength {
+		return fmt.Errorf("Template is %v characters, the limit is %v", length, maxTemplateLength)
+	}
+
+	text := placeholderPattern.ReplaceAllString(body, "")
+	if text == "" {
+		return nil
+	}
+	return validateBody(text)
+}
+
+// renderTemplate looks up a template by id or name and renders it
+func renderTemplate(db *gorm.DB, id string, variables map[string]string) (string, error) {
+	var t Template
+	if db.Where("id = ? OR name = ?", id, id).First(&t).RecordNotFound() {
+		return "", fmt.Errorf("Template %v not found", id)
+	}
+
+	body, err := renderPlaceholders(t.Body, variables)
+	if err != nil {
+		return "", err
+	}
+	return body, validateBody(body)
+}
+
+func createTemplatesHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			templates := []Template{}
+			if err := db.Order("name").Find(&templates).Error; err != nil {
+				http.Error(w, "500 Failed to list.", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, templates)
+		case "POST":
+			decoder := json.NewDecoder(r.Body)
+			var t Template
+			err := decoder.Decode(&t)
+			defer r.Body.Close()
+			if err != nil || t.Name == "" {
+				http.Error(w, "400 Bad request.", http.StatusBadRequest)
+				return
+			}
+			if err := validateTemplateBody(t.Body); err != nil {
+				http.Error(w, "400 "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			t.ID = uuid.New().String()
+			if err := db.Create(&t).Error; err != nil {
+				// names are unique, so a failed insert may be a taken name
+				if !db.Where("name = ?", t.Name).First(&Template{}).RecordNotFound() {
+					http.Error(w, "409 Template name is taken.", http.StatusConflict)
+					return
+				}
+				http.Error(w, "500 Failed to create.", http.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(w, http.StatusCreated, t)
+		default:
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+	}
+}
+
+func createTemplateHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/templates/")
+
+		var t Template
+		if db.Where("id = ?", id).First(&t).RecordNotFound() {
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			writeJSON(w, http.StatusOK, t)
+		case "DELETE":
+			db.Delete(&t)
+			writeJSON(w, http.StatusOK, t)
+		default:
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRenderPlaceholders(t *testing.T) {
+	Convey("Rendering placeholders", t, func() {
+		Convey("should fill in variables", func() {
+			body, err := renderPlaceholders("Hi {{name}}, see you at {{ time }}", map[string]string{"name": "Sam", "time": "9am"})
+			So(err, ShouldBeNil)
+			So(body, ShouldEqual, "Hi Sam, see you at 9am")
+		})
+
+		Convey("should fail on missing variables", func() {
+			_, err := renderPlaceholders("Hi {{name}}", map[string]string{})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestValidateBody(t *testing.T) {
+	Convey("Validating bodies", t, func() {
+		Convey("should allow a full message", func() {
+			So(validateBody(strings.Repeat("a", 160)), ShouldBeNil)
+		})
+
+		Convey("should count extension characters twice", func() {
+			So(validateBody(strings.Repeat("a", 159)+"€"), ShouldNotBeNil)
+		})
+
+		Convey("should reject characters outside the GSM alphabet", func() {
+			So(validateBody("hi 😀"), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestValidateTemplateBody(t *testing.T) {
+	Convey("Validating template bodies", t, func() {
+		Convey("should allow placeholders longer than a message", func() {
+			So(validateTemplateBody("Hi {{"+strings.Repeat("a", 200)+"}}"), ShouldBeNil)
+		})
+
+		Convey("should reject text which can't fit in a message", func() {
+			So(validateTemplateBody(strings.Repeat("a", 161)+"{{name}}"), ShouldNotBeNil)
+		})
+
+		Convey("should reject bodies too long to store", func() {
+			So(validateTemplateBody("{{"+strings.Repeat("a", 254)+"}}"), ShouldNotBeNil)
+		})
+
+		Convey("should reject characters outside the GSM alphabet", func() {
+			So(validateTemplateBody("Hi {{name}} 😀"), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestCreateTemplate(t *testing.T) {
+	Convey("Creating a template", t, func() {
+		db, err := newTestDB()
+		So(err, ShouldBeNil)
+		defer db.Close()
+
+		handler := createTemplatesHandler(db)
+		post := func(body string) int {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("POST", "/api/templates", strings.NewReader(body)))
+			return w.Code
+		}
+
+		Convey("should store a valid template", func() {
+			So(post(`{"name":"appointment","body":"Hi {{name}}"}`), ShouldEqual, http.StatusCreated)
+		})
+
+		Convey("should refuse an invalid body", func() {
+			So(post(`{"name":"appointment","body":"Hi {{name}} 😀"}`), ShouldEqual, http.StatusBadRequest)
+		})
+
+		Convey("should refuse a taken name", func() {
+			So(post(`{"name":"appointment","body":"Hi {{name}}"}`), ShouldEqual, http.StatusCreated)
+			So(post(`{"name":"appointment","body":"Bye {{name}}"}`), ShouldEqual, http.StatusConflict)
+		})
+	})
+}
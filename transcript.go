@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// transcript directions, as in gogsmmodem's MockSerialPort replays
+const (
+	transcriptWrite = "->"
+	transcriptRead  = "<-"
+)
+
+const transcriptTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// transcriptRecorder writes serial traffic to rotating files, one timestamped
+// line per read or write with the data quoted:
+//
+//	2018-05-01T16:00:00.000000Z -> "AT+CSQ\r\n"
+//	2018-05-01T16:00:00.052114Z <- "\r\n+CSQ: 20,99\r\n\r\nOK\r\n"
+type transcriptRecorder struct {
+	mutex    sync.Mutex
+	dir      string
+	maxBytes int64
+	keep     int
+	enabled  bool
+	file     *os.File
+	size     int64
+}
+
+type transcriptStatus struct {
+	Enabled bool   `json:"enabled"`
+	Dir     string `json:"dir"`
+	File    string `json:"file,omitempty"`
+}
+
+func newTranscriptRecorder(dir string, maxBytes int64, keep int) *transcriptRecorder {
+	return &transcriptRecorder{dir: dir, maxBytes: maxBytes, keep: keep}
+}
+
+func (t *transcriptRecorder) setEnabled(enabled bool) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if enabled == t.enabled {
+		return nil
+	}
+	if !enabled {
+		t.enabled = false
+		return t.close()
+	}
+
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return err
+	}
+	if err := t.rotate(); err != nil {
+		return err
+	}
+	t.enabled = true
+	return nil
+}
+
+func (t *transcriptRecorder) status() transcriptStatus {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	status := transcriptStatus{Enabled: t.enabled, Dir: t.dir}
+	if t.file != nil {
+		status.File = t.file.Name()
+	}
+	return status
+}
+
+func (t *transcriptRecorder) close() error {
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
+
+// rotate starts a new file, removing the oldest beyond the number to keep
+func (t *transcriptRecorder) rotate() error {
+	if err := t.close(); err != nil {
+		return err
+	}
+
+	name := filepath.Join(t.dir, "transcript-"+time.Now().UTC().Format("20060102T150405.000000")+".log")
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	t.file = file
+	t.size = 0
+
+	names, err := filepath.Glob(filepath.Join(t.dir, "transcript-*.log"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for len(names) > t.keep && t.keep > 0 {
+		os.Remove(names[0])
+		names = names[1:]
+	}
+	return nil
+}
+
+func (t *transcriptRecorder) record(direction string, data []byte) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.enabled {
+		return
+	}
+
+	line := fmt.Sprintf("%v %v %v\n", time.Now().UTC().Format(transcriptTimeFormat), direction, strconv.Quote(string(data)))
+	if t.maxBytes > 0 && t.size+int64(len(line)) > t.maxBytes && t.size > 0 {
+		if err := t.rotate(); err != nil {
+			log.Printf("Stopping transcript: %v\n", err)
+			t.enabled = false
+			return
+		}
+	}
+
+	n, err := t.file.WriteString(line)
+	t.size += int64(n)
+	if err != nil {
+		log.Printf("Stopping transcript: %v\n", err)
+		t.enabled = false
+		t.close()
+	}
+}
+
+// transcriptPort records everything read from and written to the modem
+type transcriptPort struct {
+	port     io.ReadWriteCloser
+	recorder *transcriptRecorder
+}
+
+func (p *transcriptPort) Read(b []byte) (int, error) {
+	n, err := p.port.Read(b)
+	if n > 0 {
+		p.recorder.record(transcriptRead, b[:n])
+	}
+	return n, err
+}
+
+func (p *transcriptPort) Write(b []byte) (int, error) {
+	p.recorder.record(transcriptWrite, b)
+	return p.port.Write(b)
+}
+
+func (p *transcriptPort) Close() error {
+	return p.port.Close()
+}
+
+// readTranscript parses a transcript into a gogsmmodem MockSerialPort replay
+func readTranscript(r io.Reader) ([]string, error) {
+	replay := []string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		fields := strings.SplitN(scanner.Text(), " ", 3)
+		if len(fields) != 3 || (fields[1] != transcriptWrite && fields[1] != transcriptRead) {
+			return nil, fmt.Errorf("Malformed transcript line %v", line)
+		}
+		data, err := strconv.Unquote(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("Malformed transcript line %v: %v", line, err)
+		}
+		replay = append(replay, fields[1]+data)
+	}
+	return replay, scanner.Err()
+}
+
+func createTranscriptHandler(recorder *transcriptRecorder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			writeJSON(w, http.StatusOK, recorder.status())
+		case "PUT":
+			var req struct {
+				Enabled *bool `json:"enabled"`
+			}
+			err := json.NewDecoder(r.Body).Decode(&req)
+			defer r.Body.Close()
+			if err != nil || req.Enabled == nil {
+				http.Error(w, "400 Bad request.", http.StatusBadRequest)
+				return
+			}
+
+			if err := recorder.setEnabled(*req.Enabled); err != nil {
+				log.Println(err.Error())
+				http.Error(w, "500 Failed to update transcript.", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, recorder.status())
+		default:
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+	}
+}
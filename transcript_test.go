@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakePort reads from in and writes to out
+type fakePort struct {
+	in  bytes.Buffer
+	out bytes.Buffer
+}
+
+func (p *fakePort) Read(b []byte) (int, error) {
+	return p.in.Read(b)
+}
+
+func (p *fakePort) Write(b []byte) (int, error) {
+	return p.out.Write(b)
+}
+
+func (p *fakePort) Close() error {
+	return nil
+}
+
+func TestTranscript(t *testing.T) {
+	Convey("Recording a transcript", t, func() {
+		dir, _ := ioutil.TempDir("", "transcript")
+		defer os.RemoveAll(dir)
+
+		recorder := newTranscriptRecorder(dir, 0, 2)
+		port := &transcriptPort{port: &fakePort{}, recorder: recorder}
+
+		Convey("should record nothing until enabled", func() {
+			port.Write([]byte("ATZ\r\n"))
+			So(recorder.status().File, ShouldEqual, "")
+		})
+
+		Convey("should replay what was written and read", func() {
+			So(recorder.setEnabled(true), ShouldBeNil)
+			port.Write([]byte("AT+CSQ\r\n"))
+			port.port.(*fakePort).in.WriteString("\r\n+CSQ: 20,99\r\n\r\nOK\r\n")
+			port.Read(make([]byte, 64))
+
+			file := recorder.status().File
+			So(recorder.setEnabled(false), ShouldBeNil)
+
+			contents, _ := ioutil.ReadFile(file)
+			replay, err := readTranscript(bytes.NewReader(contents))
+			So(err, ShouldBeNil)
+			So(replay, ShouldResemble, []string{"->AT+CSQ\r\n", "<-\r\n+CSQ: 20,99\r\n\r\nOK\r\n"})
+		})
+
+		Convey("should rotate and keep the newest files", func() {
+			recorder.maxBytes = 60
+			So(recorder.setEnabled(true), ShouldBeNil)
+			for i := 0; i < 5; i++ {
+				port.Write([]byte("AT+CSQ\r\n"))
+			}
+			recorder.setEnabled(false)
+
+			names, _ := filepath.Glob(filepath.Join(dir, "transcript-*.log"))
+			So(len(names), ShouldEqual, 2)
+		})
+	})
+
+	Convey("Reading a malformed transcript", t, func() {
+		_, err := readTranscript(strings.NewReader("2018-05-01T16:00:00Z => \"ATZ\"\n"))
+		So(err, ShouldNotBeNil)
+	})
+}
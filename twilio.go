@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// A Twilio compatible messaging api so existing client libraries can send
+// through the gateway
+
+const twilioAPIVersion = "2010-04-01"
+
+type twilioMessage struct {
+	Sid          string  `json:"sid"`
+	AccountSid   string  `json:"account_sid"`
+	To           string  `json:"to"`
+	From         string  `json:"from"`
+	Body         string  `json:"body"`
+	Status       string  `json:"status"`
+	Direction    string  `json:"direction"`
+	NumSegments  string  `json:"num_segments"`
+	DateCreated  string  `json:"date_created"`
+	DateUpdated  string  `json:"date_updated"`
+	DateSent     *string `json:"date_sent"`
+	Price        *string `json:"price"`
+	ErrorCode    *int    `json:"error_code"`
+	ErrorMessage *string `json:"error_message"`
+	APIVersion   string  `json:"api_version"`
+	URI          string  `json:"uri"`
+}
+
+type twilioErrorResponse struct {
+	Code     int    `json:"code"`
+	Message  string `json:"message"`
+	MoreInfo string `json:"more_info"`
+	Status   int    `json:"status"`
+}
+
+type twilioMessageList struct {
+	Messages []twilioMessage `json:"messages"`
+	Page     int             `json:"page"`
+	PageSize int             `json:"page_size"`
+	URI      string          `json:"uri"`
+}
+
+// message sids are the message id as SM followed by 32 hex digits
+func twilioSid(id string) string {
+	return "SM" + strings.Replace(id, "-", "", -1)
+}
+
+func messageIDFromSid(sid string) string {
+	hex := strings.TrimPrefix(sid, "SM")
+	if len(hex) != 32 {
+		return ""
+	}
+	return hex[0:8] + "-" + hex[8:12] + "-" + hex[12:16] + "-" + hex[16:20] + "-" + hex[20:]
+}
+
+func twilioStatus(m *Message) string {
+	switch m.Status {
+	case StatusScheduled, StatusDelayed, StatusPaused:
+		return "queued"
+	case StatusSending:
+		return "sending"
+	case StatusSent:
+		return "sent"
+	case StatusFailed:
+		return "failed"
+	case StatusSuppressed:
+		return "undelivered"
+	case StatusCancelled:
+		return "canceled"
+	case StatusReceived:
+		return "received"
+	}
+	return m.Status
+}
+
+func newTwilioMessage(accountSid string, modemName string, m *Message) twilioMessage {
+	t := twilioMessage{
+		Sid:         twilioSid(m.ID),
+		AccountSid:  accountSid,
+		To:          m.Number,
+		From:        modemName,
+		Body:        m.Body,
+		Status:      twilioStatus(m),
+		Direction:   "outbound-api",
+		NumSegments: "1",
+		DateCreated: m.CreatedAt.Format(time.RFC1123Z),
+		DateUpdated: m.UpdatedAt.Format(time.RFC1123Z),
+		APIVersion:  twilioAPIVersion,
+		URI:         fmt.Sprintf("/%v/Accounts/%v/Messages/%v.json", twilioAPIVersion, accountSid, twilioSid(m.ID)),
+	}
+
+	if m.Incoming {
+		t.To, t.From = modemName, m.Number
+		t.Direction = "inbound"
+	}
+	if m.Status == StatusSent || m.Status == StatusReceived {
+		sent := m.Time.Format(time.RFC1123Z)
+		t.DateSent = &sent
+	}
+	if m.Status == StatusFailed || m.Status == StatusSuppressed {
+		code := 30008
+		message := "Unknown error"
+		if m.Status == StatusSuppressed {
+			code = 21610
+			message = "Attempt to send to unsubscribed recipient"
+		}
+		t.ErrorCode = &code
+		t.ErrorMessage = &message
+	}
+	return t
+}
+
+func writeTwilioError(w http.ResponseWriter, status int, code int, message string) {
+	writeJSON(w, status, twilioErrorResponse{
+		Code:     code,
+		Message:  message,
+		MoreInfo: fmt.Sprintf("https://www.twilio.com/docs/errors/%v", code),
+		Status:   status,
+	})
+}
+
+func createTwilioHandler(db *gorm.DB, format *numberFormat, accountSid string, authToken string, modemName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// /2010-04-01/Accounts/{sid}/Messages.json or
+		// /2010-04-01/Accounts/{sid}/Messages/{MessageSid}.json
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"+twilioAPIVersion+"/Accounts/"), "/")
+
+		user, password, ok := r.BasicAuth()
+		if !ok || user != accountSid || subtle.ConstantTimeCompare([]byte(password), []byte(authToken)) != 1 || parts[0] != accountSid {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Twilio API"`)
+			writeTwilioError(w, http.StatusUnauthorized, 20003, "Authenticate")
+			return
+		}
+
+		if len(parts) == 3 && parts[1] == "Messages" && strings.HasSuffix(parts[2], ".json") {
+			var m Message
+			id := messageIDFromSid(strings.TrimSuffix(parts[2], ".json"))
+			if id == "" || r.Method != "GET" || db.Where("id = ?", id).First(&m).RecordNotFound() {
+				writeTwilioError(w, http.StatusNotFound, 20404, "The requested resource was not found")
+				return
+			}
+			writeJSON(w, http.StatusOK, newTwilioMessage(accountSid, modemName, &m))
+			return
+		}
+		if len(parts) != 2 || parts[1] != "Messages.json" {
+			writeTwilioError(w, http.StatusNotFound, 20404, "The requested resource was not found")
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			pageSize, _ := strconv.Atoi(r.URL.Query().Get("PageSize"))
+			if pageSize <= 0 || pageSize > 1000 {
+				pageSize = 50
+			}
+			page, _ := strconv.Atoi(r.URL.Query().Get("Page"))
+
+			query := db.Order("created_at desc").Limit(pageSize).Offset(page * pageSize)
+			if to := r.URL.Query().Get("To"); to != "" {
+				query = query.Where("number = ? AND incoming = ?", format.normalizeSender(to), false)
+			}
+			if from := r.URL.Query().Get("From"); from != "" {
+				query = query.Where("number = ? AND incoming = ?", format.normalizeSender(from), true)
+			}
+
+			var messages []Message
+			if err := query.Find(&messages).Error; err != nil {
+				writeTwilioError(w, http.StatusInternalServerError, 20500, "Internal Server Error")
+				return
+			}
+
+			list := twilioMessageList{Messages: []twilioMessage{}, Page: page, PageSize: pageSize, URI: r.URL.RequestURI()}
+			for i := range messages {
+				list.Messages = append(list.Messages, newTwilioMessage(accountSid, modemName, &messages[i]))
+			}
+			writeJSON(w, http.StatusOK, list)
+		case "POST":
+			if err := r.ParseForm(); err != nil {
+				writeTwilioError(w, http.StatusBadRequest, 20001, "Could not parse form")
+				return
+			}
+
+			m := Message{
+				Number:         r.PostForm.Get("To"),
+				Body:           r.PostForm.Get("Body"),
+				StatusCallback: r.PostForm.Get("StatusCallback"),
+			}
+			if m.Number == "" {
+				writeTwilioError(w, http.StatusBadRequest, 21604, "A 'To' phone number is required.")
+				return
+			}
+			if m.Body == "" {
+				writeTwilioError(w, http.StatusBadRequest, 21602, "Message body is required.")
+				return
+			}
+
+			err := enqueueMessage(db, format, &m)
+			if err == errSuppressed {
+				writeTwilioError(w, http.StatusBadRequest, 21610, "Attempt to send to unsubscribed recipient")
+				return
+			} else if _, ok := err.(invalidMessageError); ok {
+				writeTwilioError(w, http.StatusBadRequest, 21211, fmt.Sprintf("Invalid 'To' Phone Number or Body: %v", err))
+				return
+			} else if err != nil {
+				writeTwilioError(w, http.StatusInternalServerError, 20500, "Internal Server Error")
+				return
+			}
+
+			writeJSON(w, http.StatusCreated, newTwilioMessage(accountSid, modemName, &m))
+		default:
+			writeTwilioError(w, http.StatusMethodNotAllowed, 20004, "Method not allowed")
+		}
+	}
+}
+
+// statusCallbackClient keeps a slow callback url from holding up the others
+var statusCallbackClient = &http.Client{Timeout: 10 * time.Second}
+
+// postStatusCallback notifies a message's StatusCallback of a final status
+func postStatusCallback(accountSid string, modemName string, m *Message) error {
+	status := twilioStatus(m)
+	switch status {
+	case "sent", "failed", "undelivered", "canceled":
+	default:
+		return nil
+	}
+
+	form := url.Values{
+		"AccountSid":    {accountSid},
+		"ApiVersion":    {twilioAPIVersion},
+		"MessageSid":    {twilioSid(m.ID)},
+		"SmsSid":        {twilioSid(m.ID)},
+		"MessageStatus": {status},
+		"SmsStatus":     {status},
+		"To":            {m.Number},
+		"From":          {modemName},
+	}
+	res, err := statusCallbackClient.PostForm(m.StatusCallback, form)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func listenOnTwilio(db *gorm.DB, format *numberFormat, accountSid string, authToken string, modemName string) chan error {
+	errorChannel := make(chan error, 1)
+
+	http.HandleFunc("/"+twilioAPIVersion+"/Accounts/", createTwilioHandler(db, format, accountSid, authToken, modemName))
+
+	go events.follow(0, eventTypes(EventStatus), nil, func(e Event) error {
+		m, ok := e.Data.(Message)
+		if !ok || m.StatusCallback == "" {
+			return nil
+		}
+		if err := postStatusCallback(accountSid, modemName, &m); err != nil {
+			log.Printf("Status callback for %v failed\n", m.ID)
+			errorChannel <- err
+		}
+		return nil
+	})
+
+	return errorChannel
+}
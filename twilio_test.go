@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTwilioSid(t *testing.T) {
+	Convey("Converting message ids to sids", t, func() {
+		id := "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+
+		Convey("should round trip", func() {
+			sid := twilioSid(id)
+			So(sid, ShouldEqual, "SM6ba7b8109dad11d180b400c04fd430c8")
+			So(messageIDFromSid(sid), ShouldEqual, id)
+		})
+
+		Convey("should reject malformed sids", func() {
+			So(messageIDFromSid("SM1234"), ShouldEqual, "")
+		})
+	})
+}
+
+func TestStatusCallback(t *testing.T) {
+	Convey("Posting a status callback", t, func() {
+		hang := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-hang
+		}))
+		defer server.Close()
+		defer close(hang)
+
+		client := statusCallbackClient
+		statusCallbackClient = &http.Client{Timeout: 50 * time.Millisecond}
+		defer func() { statusCallbackClient = client }()
+
+		Convey("should give up on a slow callback url", func() {
+			m := Message{ID: "6ba7b810-9dad-11d1-80b4-00c04fd430c8", Status: StatusSent, StatusCallback: server.URL}
+			start := time.Now()
+			So(postStatusCallback("AC123", "test", &m), ShouldNotBeNil)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+		})
+	})
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"net/http"
+)
+
+// adminPage is the admin web ui.  It only uses the api, authenticating with an
+// api key or the admin token kept in the browser's local storage.
+const adminPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>gsm-gateway</title>
+<style>
+body { font-family: sans-serif; margin: 0; color: #222; background: #f4f4f4; }
+header { background: #333; color: #fff; padding: 8px 16px; display: flex; align-items: center; }
+header h1 { font-size: 18px; margin: 0 24px 0 0; }
+header a { color: #ccc; margin-right: 16px; text-decoration: none; cursor: pointer; }
+header a.active { color: #fff; font-weight: bold; }
+header .right { margin-left: auto; }
+main { padding: 16px; }
+section { display: none; }
+section.active { display: block; }
+.panel { background: #fff; border: 1px solid #ddd; padding: 12px; margin-bottom: 16px; }
+.inbox { display: flex; }
+.conversations { width: 300px; margin-right: 16px; max-height: 80vh; overflow-y: auto; }
+.conversation { padding: 8px; border-bottom: 1px solid #eee; cursor: pointer; }
+.conversation.active { background: #e8f0fe; }
+.conversation .preview { color: #666; font-size: 13px; white-space: nowrap; overflow: hidden; text-overflow: ellipsis; }
+.thread { flex: 1; }
+.messages { max-height: 60vh; overflow-y: auto; }
+.bubble { max-width: 70%; padding: 6px 10px; margin: 6px 0; border-radius: 8px; clear: both; }
+.bubble.in { background: #eee; float: left; }
+.bubble.out { background: #d2e3fc; float: right; }
+.bubble .meta { font-size: 11px; color: #666; }
+.clear { clear: both; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #eee; font-size: 14px; }
+textarea { width: 100%; height: 80px; }
+input[type=text], input[type=password] { width: 300px; }
+.error { color: #b00; }
+.bars span { display: inline-block; width: 6px; margin-right: 2px; background: #ccc; vertical-align: bottom; }
+.bars span.on { background: #2a2; }
+</style>
+</head>
+<body>
+<header>
+  <h1>gsm-gateway</h1>
+  <a data-view="inbox">Inbox</a>
+  <a data-view="queue">Outbox</a>
+  <a data-view="compose">Compose</a>
+  <a data-view="modem">Modem</a>
+  <a class="right" id="logout">Sign out</a>
+</header>
+<main>
+  <section id="login">
+    <div class="panel">
+      <p>Enter an api key or the admin token.</p>
+      <input type="password" id="token"> <button id="signin">Sign in</button>
+      <p class="error" id="login-error"></p>
+    </div>
+  </section>
+
+  <section id="inbox">
+    <div class="inbox">
+      <div class="panel conversations" id="conversations"></div>
+      <div class="panel thread">
+        <h3 id="thread-number">Select a conversation</h3>
+        <div class="messages" id="thread"></div>
+        <div class="clear"></div>
+        <form id="reply" style="display: none">
+          <textarea id="reply-body" maxlength="160"></textarea>
+          <button type="submit">Reply</button> <span class="error" id="reply-error"></span>
+        </form>
+      </div>
+    </div>
+  </section>
+
+  <section id="queue">
+    <div class="panel">
+      Status
+      <select id="queue-status">
+        <option>scheduled</option>
+        <option>delayed</option>
+        <option>sending</option>
+        <option>failed</option>
+        <option>sent</option>
+        <option>cancelled</option>
+        <option>suppressed</option>
+        <option>paused</option>
+      </select>
+      <table>
+        <thead><tr><th>Number</th><th>Status</th><th>Send at</th><th>Time</th><th>Reason</th><th>Body</th><th></th></tr></thead>
+        <tbody id="queue-rows"></tbody>
+      </table>
+    </div>
+  </section>
+
+  <section id="compose">
+    <div class="panel">
+      <form id="compose-form">
+        <p>Number<br><input type="text" id="compose-number"></p>
+        <p>Message <span id="compose-count">0/160</span><br><textarea id="compose-body" maxlength="160"></textarea></p>
+        <p>Send at (optional)<br><input type="datetime-local" id="compose-at"></p>
+        <button type="submit">Send</button>
+      </form>
+      <p id="compose-result"></p>
+    </div>
+  </section>
+
+  <section id="modem">
+    <div class="panel">
+      <table id="modem-status"></table>
+    </div>
+  </section>
+</main>
+
+<script>
+var tokenKey = 'gsm-gateway-token';
+var view = 'inbox';
+var selectedNumber = '';
+
+function el(id) { return document.getElementById(id); }
+
+function node(tag, className, text) {
+  var n = document.createElement(tag);
+  if (className) { n.className = className; }
+  if (text !== undefined) { n.textContent = text; }
+  return n;
+}
+
+function formatTime(t) {
+  return t ? new Date(t).toLocaleString() : '';
+}
+
+function api(method, path, body) {
+  var options = { method: method, headers: { 'Authorization': 'Bearer ' + (localStorage.getItem(tokenKey) || '') } };
+  if (body) {
+    options.headers['Content-Type'] = 'application/json';
+    options.body = JSON.stringify(body);
+  }
+  return fetch(path, options).then(function(res) {
+    if (res.status === 401) {
+      show('login');
+      throw new Error('Unauthorized');
+    }
+    if (!res.ok) {
+      return res.text().then(function(text) { throw new Error(text.trim()); });
+    }
+    return res.json();
+  });
+}
+
+function show(name) {
+  view = name;
+  var sections = document.querySelectorAll('section');
+  for (var i = 0; i < sections.length; i++) {
+    sections[i].className = sections[i].id === name ? 'active' : '';
+  }
+  var links = document.querySelectorAll('header a[data-view]');
+  for (var j = 0; j < links.length; j++) {
+    links[j].className = links[j].getAttribute('data-view') === name ? 'active' : '';
+  }
+  refresh();
+}
+
+function refresh() {
+  if (view === 'inbox') { loadConversations(); }
+  if (view === 'queue') { loadQueue(); }
+  if (view === 'modem') { loadModem(); }
+}
+
+function loadConversations() {
+  api('GET', '/api/conversations').then(function(conversations) {
+    var list = el('conversations');
+    list.innerHTML = '';
+    conversations.forEach(function(c) {
+      var item = node('div', 'conversation' + (c.number === selectedNumber ? ' active' : ''));
+      item.appendChild(node('strong', '', c.number));
+      item.appendChild(node('span', 'meta', ' (' + c.count + ') ' + formatTime(c.last_message.time)));
+      item.appendChild(node('div', 'preview', c.last_message.body));
+      item.onclick = function() { selectedNumber = c.number; loadConversations(); };
+      list.appendChild(item);
+    });
+    if (selectedNumber) { loadThread(); }
+  });
+}
+
+function loadThread() {
+  api('GET', '/api/messages?number=' + encodeURIComponent(selectedNumber)).then(function(messages) {
+    el('thread-number').textContent = selectedNumber;
+    el('reply').style.display = '';
+    var thread = el('thread');
+    thread.innerHTML = '';
+    messages.forEach(function(m) {
+      var incoming = m.status === 'received';
+      var bubble = node('div', 'bubble ' + (incoming ? 'in' : 'out'));
+      bubble.appendChild(node('div', '', m.body));
+      bubble.appendChild(node('div', 'meta', formatTime(m.time) + (incoming ? '' : ' - ' + m.status)));
+      thread.appendChild(bubble);
+    });
+    thread.scrollTop = thread.scrollHeight;
+  });
+}
+
+function loadQueue() {
+  var status = el('queue-status').value;
+  api('GET', '/api/messages?status=' + status).then(function(messages) {
+    var rows = el('queue-rows');
+    rows.innerHTML = '';
+    messages.reverse().forEach(function(m) {
+      var row = node('tr');
+      [m.number, m.status, formatTime(m.send_at), formatTime(m.time), m.delay_reason || '', m.body].forEach(function(text) {
+        row.appendChild(node('td', '', text));
+      });
+      var actions = node('td');
+      if (m.status === 'scheduled' || m.status === 'delayed') {
+        var cancel = node('button', '', 'Cancel');
+        cancel.onclick = function() {
+          api('DELETE', '/api/messages/' + m.id).then(loadQueue, function(err) { alert(err.message); });
+        };
+        actions.appendChild(cancel);
+      }
+      row.appendChild(actions);
+      rows.appendChild(row);
+    });
+  });
+}
+
+function signalBars(dbm) {
+  var bars = node('span', 'bars');
+  // roughly -113 dBm (none) to -51 dBm (excellent)
+  var level = Math.round((dbm + 113) / 62 * 5);
+  for (var i = 1; i <= 5; i++) {
+    var bar = node('span', i <= level ? 'on' : '');
+    bar.style.height = (i * 4) + 'px';
+    bars.appendChild(bar);
+  }
+  return bars;
+}
+
+function loadModem() {
+  api('GET', '/api/status').then(function(status) {
+    var table = el('modem-status');
+    table.innerHTML = '';
+    function add(label, value) {
+      var row = node('tr');
+      row.appendChild(node('th', '', label));
+      var cell = node('td');
+      if (typeof value === 'string') { cell.textContent = value; } else { cell.appendChild(value); }
+      row.appendChild(cell);
+      table.appendChild(row);
+    }
+    var modem = status.modem;
+    add('Modem', modem.modem);
+    add('Service', modem.service || 'unknown');
+    add('Network', modem.network || 'unknown');
+    if (modem.signal_dbm !== undefined) {
+      var signal = signalBars(modem.signal_dbm);
+      signal.appendChild(document.createTextNode(' ' + modem.signal_dbm + ' dBm'));
+      add('Signal', signal);
+    } else {
+      add('Signal', 'unknown');
+    }
+    add('SIM storage', modem.storage_used + ' of ' + modem.storage_total + ' messages');
+    add('Checked', formatTime(modem.health_checked_at));
+    var counts = Object.keys(status.queue).sort().map(function(s) { return s + ' ' + status.queue[s]; });
+    add('Messages', counts.join(', '));
+  });
+}
+
+function send(number, body, sendAt) {
+  var message = { number: number, body: body };
+  if (sendAt) { message.send_at = sendAt; }
+  return api('POST', '/api/messages', message);
+}
+
+el('reply').onsubmit = function(e) {
+  e.preventDefault();
+  el('reply-error').textContent = '';
+  send(selectedNumber, el('reply-body').value).then(function() {
+    el('reply-body').value = '';
+    loadThread();
+  }, function(err) { el('reply-error').textContent = err.message; });
+};
+
+el('compose-body').oninput = function() {
+  el('compose-count').textContent = el('compose-body').value.length + '/160';
+};
+
+el('compose-form').onsubmit = function(e) {
+  e.preventDefault();
+  var at = el('compose-at').value;
+  var result = el('compose-result');
+  result.className = '';
+  send(el('compose-number').value, el('compose-body').value, at ? new Date(at).toISOString() : '').then(function(m) {
+    result.textContent = 'Message to ' + m.number + ' is ' + m.status + '.';
+    el('compose-body').value = '';
+  }, function(err) {
+    result.className = 'error';
+    result.textContent = err.message;
+  });
+};
+
+el('queue-status').onchange = loadQueue;
+
+el('signin').onclick = function() {
+  localStorage.setItem(tokenKey, el('token').value);
+  api('GET', '/api/status').then(function() {
+    el('login-error').textContent = '';
+    listen();
+    show('inbox');
+  }, function(err) { el('login-error').textContent = err.message; });
+};
+
+el('logout').onclick = function() {
+  localStorage.removeItem(tokenKey);
+  show('login');
+};
+
+var links = document.querySelectorAll('header a[data-view]');
+for (var i = 0; i < links.length; i++) {
+  links[i].onclick = function() { show(this.getAttribute('data-view')); };
+}
+
+// refresh the current view as events arrive, at most once a second
+var events;
+var pending;
+function listen() {
+  if (events) { events.close(); }
+  events = new EventSource('/api/events?access_token=' + encodeURIComponent(localStorage.getItem(tokenKey) || ''));
+  ['inbound', 'status', 'modem'].forEach(function(type) {
+    events.addEventListener(type, function() {
+      if (!pending) {
+        pending = setTimeout(function() { pending = null; refresh(); }, 1000);
+      }
+    });
+  });
+}
+
+listen();
+show('inbox');
+setInterval(refresh, 30000);
+</script>
+</body>
+</html>
+`
+
+func createAdminHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "404 not found.", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(adminPage))
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestModemHealth(t *testing.T) {
+	Convey("Parsing signal quality", t, func() {
+		dbm, err := parseSignal([]string{"+CSQ: 20,99"})
+		So(err, ShouldBeNil)
+		So(*dbm, ShouldEqual, -73)
+
+		Convey("should be unknown when the modem can't tell", func() {
+			dbm, err := parseSignal([]string{"+CSQ: 99,99"})
+			So(err, ShouldBeNil)
+			So(dbm, ShouldBeNil)
+		})
+
+		Convey("should fail without a response", func() {
+			_, err := parseSignal([]string{"ERROR"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Parsing storage", t, func() {
+		used, total, err := parseStorage([]string{`+CPMS: "SM",3,30,"SM",3,30,"SM",3,30`})
+		So(err, ShouldBeNil)
+		So(used, ShouldEqual, 3)
+		So(total, ShouldEqual, 30)
+	})
+
+	Convey("Checking modem health", t, func() {
+		h, err := newReplayHarness("", "init", "health")
+		So(err, ShouldBeNil)
+		defer h.close()
+
+		So(checkModemHealth(h.commands), ShouldBeNil)
+		So(h.done(), ShouldBeTrue)
+
+		Convey("should be reported from the cache by the status handler", func() {
+			db, err := newTestDB()
+			So(err, ShouldBeNil)
+			defer db.Close()
+
+			w := httptest.NewRecorder()
+			createStatusHandler(db)(w, httptest.NewRequest("GET", "/api/status", nil))
+			So(w.Code, ShouldEqual, http.StatusOK)
+
+			var status gatewayStatus
+			So(json.Unmarshal(w.Body.Bytes(), &status), ShouldBeNil)
+			So(*status.Modem.SignalDBM, ShouldEqual, -73)
+			So(status.Modem.StorageUsed, ShouldEqual, 3)
+			So(status.Modem.StorageTotal, ShouldEqual, 30)
+		})
+	})
+}
+
+func TestRecentConversations(t *testing.T) {
+	Convey("Grouping messages by number", t, func() {
+		db, err := newTestDB()
+		So(err, ShouldBeNil)
+		defer db.Close()
+
+		start := time.Now().Add(-time.Hour)
+		for i, number := range []string{"+15555550100", "+15555550101", "+15555550100"} {
+			m := Message{ID: string(rune('a' + i)), Number: number, Body: number, CreatedAt: start.Add(time.Duration(i) * time.Minute)}
+			So(db.Create(&m).Error, ShouldBeNil)
+		}
+
+		conversations, err := recentConversations(db, 100)
+		So(err, ShouldBeNil)
+		So(len(conversations), ShouldEqual, 2)
+		So(conversations[0].Number, ShouldEqual, "+15555550100")
+		So(conversations[0].Count, ShouldEqual, 2)
+		So(conversations[0].LastMessage.ID, ShouldEqual, "c")
+		So(conversations[1].Number, ShouldEqual, "+15555550101")
+		So(conversations[1].Count, ShouldEqual, 1)
+		So(conversations[1].LastMessage.ID, ShouldEqual, "b")
+
+		Convey("should fetch the last messages together", func() {
+			queries := 0
+			db.Callback().Query().Before("gorm:query").Register("test:count_queries", func(scope *gorm.Scope) {
+				queries++
+			})
+
+			_, err := recentConversations(db, 100)
+			So(err, ShouldBeNil)
+			// one to group the numbers and one for the last messages
+			So(queries, ShouldEqual, 2)
+		})
+
+		Convey("should limit the number of conversations rather than messages", func() {
+			for i := 0; i < 5; i++ {
+				m := Message{ID: string(rune('d' + i)), Number: "+15555550100", CreatedAt: start.Add(time.Duration(10+i) * time.Minute)}
+				So(db.Create(&m).Error, ShouldBeNil)
+			}
+
+			conversations, err := recentConversations(db, 2)
+			So(err, ShouldBeNil)
+			So(len(conversations), ShouldEqual, 2)
+			So(conversations[0].Count, ShouldEqual, 7)
+			So(conversations[0].LastMessage.ID, ShouldEqual, "h")
+			So(conversations[1].Number, ShouldEqual, "+15555550101")
+		})
+	})
+}
+
+func TestAdminHandler(t *testing.T) {
+	Convey("Serving the admin page", t, func() {
+		w := httptest.NewRecorder()
+		createAdminHandler()(w, httptest.NewRequest("GET", "/admin", nil))
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get("Content-Type"), ShouldStartWith, "text/html")
+		So(w.Body.String(), ShouldContainSubstring, "/api/conversations")
+	})
+}